@@ -0,0 +1,99 @@
+package common
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// TraceContext is the request id and the w3c trace context of a request
+type TraceContext struct {
+	RequestID string
+	TraceID   string
+	SpanID    string
+	Flags     string
+}
+
+type traceCtxKey struct{}
+
+func randHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func lowerHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil && strings.ToLower(s) == s
+}
+
+// validHex is lowerHex which is not all zero
+func validHex(s string, n int) bool {
+	return lowerHex(s, n) && strings.Trim(s, "0") != ""
+}
+
+// NewTraceContext create a trace with new ids
+func NewTraceContext() *TraceContext {
+	traceID := randHex(16)
+	return &TraceContext{
+		RequestID: traceID,
+		TraceID:   traceID,
+		SpanID:    randHex(8),
+		Flags:     "01",
+	}
+}
+
+// ParseTraceParent parse the traceparent header: version-traceid-spanid-flags
+func ParseTraceParent(s string) (*TraceContext, error) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return nil, fmt.Errorf("invalid traceparent %v", s)
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return nil, fmt.Errorf("invalid traceparent %v", s)
+	}
+	if !validHex(parts[1], 32) || !validHex(parts[2], 16) || !lowerHex(parts[3], 2) {
+		return nil, fmt.Errorf("invalid traceparent %v", s)
+	}
+	return &TraceContext{TraceID: parts[1], SpanID: parts[2], Flags: parts[3]}, nil
+}
+
+// TraceParent format the traceparent header
+func (tc *TraceContext) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-%s", tc.TraceID, tc.SpanID, tc.Flags)
+}
+
+// Child return a trace with the same trace id and a new span id, it's used
+// for the outgoing requests
+func (tc *TraceContext) Child() *TraceContext {
+	child := *tc
+	child.SpanID = randHex(8)
+	return &child
+}
+
+// WithTrace ...
+func WithTrace(ctx context.Context, tc *TraceContext) context.Context {
+	return context.WithValue(ctx, traceCtxKey{}, tc)
+}
+
+// TraceFrom return nil if ctx has no trace
+func TraceFrom(ctx context.Context) *TraceContext {
+	if ctx == nil {
+		return nil
+	}
+	tc, _ := ctx.Value(traceCtxKey{}).(*TraceContext)
+	return tc
+}
+
+// RequestIDFrom return the request id of ctx or empty string
+func RequestIDFrom(ctx context.Context) string {
+	if tc := TraceFrom(ctx); tc != nil {
+		return tc.RequestID
+	}
+	return ""
+}
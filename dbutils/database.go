@@ -3,6 +3,7 @@ package dbutils
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -137,6 +138,20 @@ func (dbs *Database) NewSession() *DBSession {
 	}
 }
 
+// NewSessionContext create a session whose events are logged with the
+// request id of ctx
+func (dbs *Database) NewSessionContext(ctx context.Context) *DBSession {
+	evtr := dbs.evtr
+	if id := common.RequestIDFrom(ctx); id != "" {
+		evtr = &requestEventReceiver{EventReceiver: evtr, requestID: id}
+	}
+	return &DBSession{
+		Session: dbs.Connection.NewSession(evtr),
+		ctx:     ctx,
+		db:      dbs,
+	}
+}
+
 // DBExecer ...
 type DBExecer interface {
 	Exec() (sql.Result, error)
@@ -166,6 +181,57 @@ type DBEventReceiver struct {
 func (er *DBEventReceiver) TimingKv(eventName string, nanoseconds int64, kvs map[string]string) {
 	seconds := time.Duration(nanoseconds).Seconds()
 	if int(seconds) > 3 {
+		// the request id is in kvs if the session has one
 		logger.Debugf("%v too slow time %v, sql:%v", eventName, seconds, kvs)
 	}
 }
+
+const kvRequestID = "request_id"
+
+// requestEventReceiver add the request id to kvs of all events
+type requestEventReceiver struct {
+	dbr.EventReceiver
+	requestID string
+}
+
+func (er *requestEventReceiver) withID(kvs map[string]string) map[string]string {
+	m := make(map[string]string, len(kvs)+1)
+	for k, v := range kvs {
+		m[k] = v
+	}
+	m[kvRequestID] = er.requestID
+	return m
+}
+
+func (er *requestEventReceiver) Event(eventName string) {
+	er.EventReceiver.EventKv(eventName, er.withID(nil))
+}
+
+func (er *requestEventReceiver) EventKv(eventName string, kvs map[string]string) {
+	er.EventReceiver.EventKv(eventName, er.withID(kvs))
+}
+
+func (er *requestEventReceiver) EventErr(eventName string, err error) error {
+	return er.EventReceiver.EventErrKv(eventName, err, er.withID(nil))
+}
+
+func (er *requestEventReceiver) EventErrKv(eventName string, err error, kvs map[string]string) error {
+	return er.EventReceiver.EventErrKv(eventName, err, er.withID(kvs))
+}
+
+func (er *requestEventReceiver) Timing(eventName string, nanoseconds int64) {
+	er.EventReceiver.TimingKv(eventName, nanoseconds, er.withID(nil))
+}
+
+func (er *requestEventReceiver) TimingKv(eventName string, nanoseconds int64, kvs map[string]string) {
+	er.EventReceiver.TimingKv(eventName, nanoseconds, er.withID(kvs))
+}
+
+// Ping check the connection of database, it is used as health check
+func (dbs *Database) Ping(ctx context.Context) error {
+	conn := dbs.Connection
+	if conn == nil || conn.DB == nil {
+		return errors.New("database not opened")
+	}
+	return conn.PingContext(ctx)
+}
@@ -0,0 +1,223 @@
+package netserve
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asmexie/gopub/common"
+	"github.com/asmexie/gopub/netutils"
+	"github.com/asmexie/go-logger/logger"
+)
+
+// access log formats
+const (
+	AccessLogCombined = "combined"
+	AccessLogJSON     = "json"
+)
+
+// HeaderRequestID ...
+const HeaderRequestID = netutils.HeaderRequestID
+
+// AccessLogConfig ...
+type AccessLogConfig struct {
+	// Format is combined or json, default combined
+	Format string
+	// SampleRates log only a part of the successful requests whose path has
+	// the prefix, the longest prefix is used, rate is from 0 to 1
+	SampleRates map[string]float64
+}
+
+// AccessLogEntry ...
+type AccessLogEntry struct {
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Query     string    `json:"query,omitempty"`
+	Proto     string    `json:"proto"`
+	Status    int       `json:"status"`
+	Bytes     int64     `json:"bytes"`
+	Duration  float64   `json:"duration_ms"`
+	RemoteIP  string    `json:"remote_ip"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Referer   string    `json:"referer,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// AccessLogger write an entry for every request, it writes to the logger
+// when there is no writer
+type AccessLogger struct {
+	config   AccessLogConfig
+	w        io.Writer
+	locker   sync.Mutex
+	ClientIP func(r *http.Request) string
+}
+
+// NewAccessLogger ...
+func NewAccessLogger(config AccessLogConfig, w io.Writer) *AccessLogger {
+	return &AccessLogger{
+		config:   config,
+		w:        w,
+		ClientIP: netutils.RemoteIP,
+	}
+}
+
+func (l *AccessLogger) sampled(path string, status int) bool {
+	if status >= http.StatusBadRequest || len(l.config.SampleRates) == 0 {
+		return true
+	}
+	rate, matched := 1.0, ""
+	for prefix, v := range l.config.SampleRates {
+		if strings.HasPrefix(path, prefix) && len(prefix) >= len(matched) {
+			rate, matched = v, prefix
+		}
+	}
+	return rate >= 1 || rand.Float64() < rate
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// Combined format the entry in combined log format, with the duration in
+// milliseconds and request id appended
+func (e *AccessLogEntry) Combined() string {
+	uri := e.Path
+	if e.Query != "" {
+		uri += "?" + e.Query
+	}
+	return fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d %d \"%s\" \"%s\" %.3f %s",
+		e.RemoteIP, e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Method, uri, e.Proto, e.Status, e.Bytes,
+		dashIfEmpty(e.Referer), dashIfEmpty(e.UserAgent), e.Duration, dashIfEmpty(e.RequestID))
+}
+
+func (l *AccessLogger) write(e *AccessLogEntry) {
+	var line string
+	if l.config.Format == AccessLogJSON {
+		data, err := json.Marshal(e)
+		if err != nil {
+			logger.Error("marshal access log failed:", err)
+			return
+		}
+		line = string(data)
+	} else {
+		line = e.Combined()
+	}
+	if l.w == nil {
+		logger.Info(line)
+		return
+	}
+	l.locker.Lock()
+	defer l.locker.Unlock()
+	io.WriteString(l.w, line+"\n")
+}
+
+// Handler log the requests served by h
+func (l *AccessLogger) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		defer func() {
+			x := recover()
+			status := sw.Status()
+			if x != nil {
+				status = http.StatusInternalServerError
+			}
+			if l.sampled(r.URL.Path, status) {
+				l.write(&AccessLogEntry{
+					Time:      start,
+					Method:    r.Method,
+					Path:      r.URL.Path,
+					Query:     r.URL.RawQuery,
+					Proto:     r.Proto,
+					Status:    status,
+					Bytes:     sw.bytes,
+					Duration:  float64(time.Since(start)) / float64(time.Millisecond),
+					RemoteIP:  l.ClientIP(r),
+					UserAgent: r.UserAgent(),
+					Referer:   r.Referer(),
+					RequestID: requestIDOf(r, w),
+				})
+			}
+			if x != nil {
+				panic(x)
+			}
+		}()
+		h.ServeHTTP(sw, r)
+	})
+}
+
+// AccessLog log requests of f, the client ip is resolved by ClientIP
+func (s *WebServe) AccessLog(f http.Handler, config AccessLogConfig, w io.Writer) http.Handler {
+	l := NewAccessLogger(config, w)
+	l.ClientIP = s.ClientIP
+	return l.Handler(f)
+}
+
+func requestIDOf(r *http.Request, w http.ResponseWriter) string {
+	if id := common.RequestIDFrom(r.Context()); id != "" {
+		return id
+	}
+	if id := w.Header().Get(HeaderRequestID); id != "" {
+		return id
+	}
+	return r.Header.Get(HeaderRequestID)
+}
+
+// statusWriter record the status and size of response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *statusWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		if w.status == 0 {
+			w.status = http.StatusSwitchingProtocols
+		}
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("response writer not support hijack")
+}
@@ -0,0 +1,112 @@
+package netserve
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	var out bytes.Buffer
+	l := NewAccessLogger(AccessLogConfig{Format: AccessLogJSON, SampleRates: map[string]float64{"/static": 0}}, &out)
+	var reqID string
+	h := RequestID(l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqID = w.Header().Get(HeaderRequestID)
+		switch r.URL.Path {
+		case "/created":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("hello"))
+			w.(http.Flusher).Flush()
+			w.WriteHeader(http.StatusOK)
+		case "/static/missing":
+			http.NotFound(w, r)
+		case "/panic":
+			panic("boom")
+		default:
+			w.Write([]byte("static"))
+		}
+	})))
+	serve := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		func() {
+			defer func() { recover() }()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		}()
+		return w
+	}
+	entry := func() (e AccessLogEntry) {
+		line, err := out.ReadString('\n')
+		if err != nil {
+			t.Fatalf("no access log: %v", err)
+		}
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	if w := serve("/created?a=1"); !w.Flushed || w.Code != http.StatusCreated {
+		t.Errorf("flush should pass through, got %v %v", w.Flushed, w.Code)
+	}
+	if e := entry(); e.Status != http.StatusCreated || e.Bytes != 5 || e.Query != "a=1" || e.RequestID == "" || e.RequestID != reqID {
+		t.Errorf("got %+v request id %v", e, reqID)
+	}
+	// successful requests of /static are not sampled but the errors are
+	serve("/static/a.js")
+	serve("/static/missing")
+	if e := entry(); e.Path != "/static/missing" || e.Status != http.StatusNotFound {
+		t.Errorf("got %+v", e)
+	}
+	serve("/panic")
+	if e := entry(); e.Path != "/panic" || e.Status != http.StatusInternalServerError {
+		t.Errorf("got %+v", e)
+	}
+	if out.Len() != 0 {
+		t.Errorf("unexpected log %v", out.String())
+	}
+}
+
+func TestAccessLogHijack(t *testing.T) {
+	var out bytes.Buffer
+	l := NewAccessLogger(AccessLogConfig{}, &out)
+	done := make(chan struct{})
+	h := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n")
+		rw.Flush()
+	}))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		h.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "test")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("got %v", resp.Status)
+	}
+	<-done
+	if line := out.String(); !strings.Contains(line, `"GET /ws HTTP/1.1" 101 0`) {
+		t.Errorf("got %v", line)
+	}
+
+	sw := &statusWriter{ResponseWriter: httptest.NewRecorder()}
+	if _, _, err := sw.Hijack(); err == nil || sw.Status() != http.StatusOK {
+		t.Errorf("hijack of recorder got %v status %v", err, sw.Status())
+	}
+}
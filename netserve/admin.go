@@ -0,0 +1,181 @@
+package netserve
+
+import (
+	"net"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/asmexie/gopub/common"
+	"github.com/asmexie/gopub/netutils"
+	"github.com/asmexie/go-logger/logger"
+	gcc "github.com/patrickmn/go-cache"
+)
+
+var (
+	gVerbosePeers sync.Map
+	// gVerboseGen is changed by SetVerbosePeer to invalidate the verbose
+	// cached by contexts, it starts from 1 so 0 is not cached
+	gVerboseGen uint32 = 1
+)
+
+func peerHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// SetVerbosePeer enable or disable verbose log of a peer ip, whatever
+// LogVerbose of the serve group is
+func SetVerbosePeer(peer string, verbose bool) {
+	peer = peerHost(peer)
+	if verbose {
+		gVerbosePeers.Store(peer, true)
+	} else {
+		gVerbosePeers.Delete(peer)
+	}
+	atomic.AddUint32(&gVerboseGen, 1)
+	logger.Infof("set peer %v verbose %v", peer, verbose)
+}
+
+// IsVerbosePeer ...
+func IsVerbosePeer(peerAddr string) bool {
+	_, ok := gVerbosePeers.Load(peerHost(peerAddr))
+	return ok
+}
+
+// VerbosePeers ...
+func VerbosePeers() (peers []string) {
+	gVerbosePeers.Range(func(k, v interface{}) bool {
+		peers = append(peers, k.(string))
+		return true
+	})
+	sort.Strings(peers)
+	return
+}
+
+// SessionInfo ...
+type SessionInfo struct {
+	Net       string  `json:"net"`
+	Handler   string  `json:"handler,omitempty"`
+	Peer      string  `json:"peer"`
+	State     byte    `json:"state"`
+	Seq       uint32  `json:"seq"`
+	Ack       uint32  `json:"ack"`
+	Age       float64 `json:"age"`
+	RecvBytes int64   `json:"recv_bytes"`
+	SendBytes int64   `json:"send_bytes"`
+	Verbose   bool    `json:"verbose"`
+}
+
+// newSessionInfo take a snapshot of the cipher state under the lock of context
+func newSessionInfo(nettype string, context *NetContext, now time.Time) SessionInfo {
+	context.locker.Lock()
+	state, seq, ack := context.state, context.seq, context.ack
+	context.locker.Unlock()
+	return SessionInfo{
+		Net:       nettype,
+		Peer:      context.peerAdrr,
+		State:     state,
+		Seq:       seq,
+		Ack:       ack,
+		Age:       now.Sub(context.created).Seconds(),
+		RecvBytes: context.recvBytes.Load(),
+		SendBytes: context.sendBytes.Load(),
+		Verbose:   context.verbose(),
+	}
+}
+
+// Sessions return the active tcp connections of serve group
+func (sg *ServeGroup) Sessions() (sessions []SessionInfo) {
+	now := time.Now()
+	sg.connsLocker.Lock()
+	defer sg.connsLocker.Unlock()
+	for c := range sg.conns {
+		info := newSessionInfo("tcp", c.context, now)
+		info.Handler = sg.nsc.HandlerName
+		sessions = append(sessions, info)
+	}
+	return
+}
+
+// UdpSessions return the cached udp net contexts
+func UdpSessions() (sessions []SessionInfo) {
+	now := time.Now()
+	var items map[string]gcc.Item
+	common.TunnelExec(gTunnelTasks, func() {
+		items = gUdpNetContext.Items()
+	})
+	for _, item := range items {
+		if context, ok := item.Object.(*NetContext); ok {
+			sessions = append(sessions, newSessionInfo("udp", context, now))
+		}
+	}
+	return
+}
+
+type adminHandler struct {
+	groups []*ServeGroup
+}
+
+// NewAdminHandler return a handler to inspect netserve sessions:
+//
+//	GET  sessions                  list tcp connections and udp contexts
+//	GET  usage                     request counters of every app
+//	POST verbose?peer=ip&on=1|0    toggle verbose log of a peer
+//
+// it should be protected by OnlyLocal
+func NewAdminHandler(groups []*ServeGroup) http.Handler {
+	return &adminHandler{groups: groups}
+}
+
+func (h *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch path.Base(r.URL.Path) {
+	case "sessions":
+		sessions := []SessionInfo{}
+		for _, sg := range h.groups {
+			sessions = append(sessions, sg.Sessions()...)
+		}
+		sessions = append(sessions, UdpSessions()...)
+		sort.Slice(sessions, func(i, j int) bool {
+			return sessions[i].Age > sessions[j].Age
+		})
+		netutils.WriteJSON(w, map[string]interface{}{
+			"sessions":      sessions,
+			"verbose_peers": VerbosePeers(),
+		})
+	case "usage":
+		usage := map[string]map[string]AppUsage{}
+		for _, sg := range h.groups {
+			usage[sg.nsc.HandlerName] = sg.AppUsage()
+		}
+		netutils.WriteJSON(w, usage)
+	case "verbose":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		peer := GetQueryStrVar(r, "peer")
+		if peer == "" {
+			http.Error(w, "peer is required", http.StatusBadRequest)
+			return
+		}
+		on := GetQueryStrVar(r, "on") != "0"
+		SetVerbosePeer(peer, on)
+		netutils.WriteJSON(w, map[string]interface{}{"peer": peerHost(peer), "verbose": on})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// HandleAdmin mount the netserve admin api under prefix, only local network
+// can access it
+func (s *WebServe) HandleAdmin(prefix string, groups []*ServeGroup) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	s.PathPrefix(prefix + "/").Handler(s.OnlyLocal(NewAdminHandler(groups)))
+}
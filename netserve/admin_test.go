@@ -0,0 +1,187 @@
+package netserve
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/asmexie/gopub/cipher2"
+)
+
+// szTestClient build the sz12 packets of client, it uses the same aes key for
+// all packets
+type szTestClient struct {
+	pub    *rsa.PublicKey
+	aeskey []byte
+	seq    uint32
+	// sent keep the iv and checksum of packets by seq to derive the send iv
+	// of server
+	sent map[uint32]szSent
+
+	acked    uint32
+	sendiv   []byte
+	compress byte
+}
+
+type szSent struct {
+	recviv   []byte
+	checksum uint64
+}
+
+func newSzTestClient(t *testing.T) (*szTestClient, []string) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := []string{"sz12", base64.StdEncoding.EncodeToString(x509.MarshalPKCS1PrivateKey(key))}
+	return &szTestClient{pub: &key.PublicKey, aeskey: bytes.Repeat([]byte{7}, 16), sent: map[uint32]szSent{}}, cfg
+}
+
+func szChecksum(data []byte) uint64 {
+	tmp := append([]byte{}, data...)
+	binary.LittleEndian.PutUint64(tmp, 0)
+	ck := md5.Sum(tmp)
+	return binary.LittleEndian.Uint64(ck[4:12])
+}
+
+func ivOf(parts ...interface{}) []byte {
+	h := md5.New()
+	for _, p := range parts {
+		if b, ok := p.([]byte); ok {
+			h.Write(b)
+		} else {
+			binary.Write(h, binary.LittleEndian, p)
+		}
+	}
+	return h.Sum(nil)
+}
+
+// Packet return the packet of msgtype 2 carrying plain in the rsa part
+func (c *szTestClient) Packet(t *testing.T, plain []byte) []byte {
+	return c.packet(t, TransPacketHdr{Msgtype: 2}, plain, nil)
+}
+
+// packet carry rsaPlain after the aes key in the rsa part and aesPlain in the
+// aes part, the msgtype of hdr is kept
+func (c *szTestClient) packet(t *testing.T, hdr TransPacketHdr, rsaPlain, aesPlain []byte) []byte {
+	c.seq++
+	hdr.Version, hdr.Seq, hdr.Nonce = 2, c.seq, uint64(c.seq)*7
+	enc, err := rsa.EncryptPKCS1v15(rand.Reader, c.pub, append(append([]byte{}, c.aeskey...), rsaPlain...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, hdr)
+	buf.Write(enc)
+	if len(aesPlain) > 0 {
+		block, _ := aes.NewCipher(c.aeskey)
+		padded, _ := cipher2.Pkcs7Pad(append([]byte{}, aesPlain...), block.BlockSize())
+		cipher.NewCBCEncrypter(block, ivOf(c.aeskey, hdr.Nonce, hdr.Seq)).CryptBlocks(padded, padded)
+		buf.Write(padded)
+	}
+	data := buf.Bytes()
+	checksum := szChecksum(data)
+	binary.LittleEndian.PutUint64(data, checksum)
+	c.sent[c.seq] = szSent{recviv: ivOf(c.aeskey, hdr.Nonce, hdr.Seq), checksum: checksum}
+
+	pkt := make([]byte, 4, 4+len(data))
+	binary.LittleEndian.PutUint32(pkt, uint32(len(data)))
+	return append(pkt, data...)
+}
+
+// ReadAck decode an ack packet of msgtype 3, the first ack of a packet derive
+// the send iv from it and the later ones reuse the iv, the payload is
+// decompressed and its algorithm is kept in compress
+func (c *szTestClient) ReadAck(pkt []byte) ([]byte, error) {
+	if len(pkt) < 4+packhdrsize+4 || int(binary.LittleEndian.Uint32(pkt)) != len(pkt)-4 {
+		return nil, fmt.Errorf("bad packet size %v", len(pkt))
+	}
+	data := append([]byte{}, pkt[4:]...)
+	var hdr TransPacketHdr
+	binary.Read(bytes.NewReader(data), binary.LittleEndian, &hdr)
+	if hdr.MsgType() != 3 || szChecksum(data) != hdr.Checksum {
+		return nil, fmt.Errorf("bad packet hdr %+v", hdr)
+	}
+	ack := binary.LittleEndian.Uint32(data[packhdrsize:])
+	if ack != c.acked {
+		sent, ok := c.sent[ack-1]
+		if !ok {
+			return nil, fmt.Errorf("unknown ack %v", ack)
+		}
+		c.acked, c.sendiv = ack, ivOf(sent.recviv, hdr.Nonce, hdr.Seq, sent.checksum)
+	}
+	enc := data[packhdrsize+4:]
+	block, err := aes.NewCipher(c.aeskey)
+	if err != nil || len(enc)%block.BlockSize() != 0 {
+		return nil, fmt.Errorf("bad packet data size %v", len(enc))
+	}
+	cipher.NewCBCDecrypter(block, c.sendiv).CryptBlocks(enc, enc)
+	plain, err := cipher2.Pkcs7Unpad(enc, block.BlockSize())
+	if err != nil {
+		return nil, err
+	}
+	c.compress = hdr.Compress()
+	return DecompressData(c.compress, plain)
+}
+
+func TestSessionsSnapshot(t *testing.T) {
+	client, cfg := newSzTestClient(t)
+	sg := &ServeGroup{cipher: NewTransCipher(cfg)}
+	c := &conn{context: NewNetContext("127.0.0.1:9")}
+	sg.trackConn(c)
+
+	packets := make([][]byte, 50)
+	for i := range packets {
+		packets[i] = client.Packet(t, []byte("msg:ping"))
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	done := make(chan struct{})
+	go func() {
+		defer wg.Done()
+		defer close(done)
+		for _, pkt := range packets {
+			sg.cipher.DecodeRead(c.context, bufio.NewReader(bytes.NewReader(pkt)))
+			var out bytes.Buffer
+			bw := bufio.NewWriter(&out)
+			sg.cipher.EncodeWrite(c.context, bw, []byte("msg:pong"))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			sg.Sessions()
+			SetVerbosePeer("127.0.0.2", i%2 == 0)
+		}
+	}()
+	wg.Wait()
+	SetVerbosePeer("127.0.0.2", false)
+
+	sessions := sg.Sessions()
+	if len(sessions) != 1 || sessions[0].Ack != uint32(len(packets)) {
+		t.Fatalf("got sessions %+v", sessions)
+	}
+	if c.context.verbose() {
+		t.Error("peer should not be verbose")
+	}
+	SetVerbosePeer("127.0.0.1", true)
+	defer SetVerbosePeer("127.0.0.1", false)
+	if !c.context.verbose() {
+		t.Error("cached verbose should be invalidated")
+	}
+}
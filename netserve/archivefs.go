@@ -0,0 +1,301 @@
+package netserve
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// EmbedFS return the file system of dir in fsys, it is used to serve the
+// files embedded by go:embed
+func EmbedFS(fsys fs.FS, dir string) (http.FileSystem, error) {
+	if dir != "" && dir != "." {
+		sub, err := fs.Sub(fsys, dir)
+		if err != nil {
+			return nil, err
+		}
+		fsys = sub
+	}
+	return http.FS(fsys), nil
+}
+
+// memEntry is a file or directory of memFS, it implements os.FileInfo
+type memEntry struct {
+	name     string
+	data     []byte
+	mode     os.FileMode
+	modTime  time.Time
+	etag     string
+	children []*memEntry
+}
+
+func (e *memEntry) Name() string       { return path.Base(e.name) }
+func (e *memEntry) Size() int64        { return int64(len(e.data)) }
+func (e *memEntry) Mode() os.FileMode  { return e.mode }
+func (e *memEntry) ModTime() time.Time { return e.modTime }
+func (e *memEntry) IsDir() bool        { return e.mode.IsDir() }
+func (e *memEntry) Sys() interface{}   { return nil }
+
+// ETag is hashed when loading, the archives may have no modify time
+func (e *memEntry) ETag() string { return e.etag }
+
+func contentETag(data []byte) string {
+	sum := sha1.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// memFS is a read only file system indexed in memory, the entries are never
+// changed after loading, so opened files are still valid after a swap
+type memFS struct {
+	entries map[string]*memEntry
+	dir     string
+}
+
+func newMemFS(dir string) *memFS {
+	dir = strings.Trim(path.Clean("/"+dir), "/")
+	m := &memFS{entries: map[string]*memEntry{}, dir: dir}
+	m.entries["/"] = &memEntry{name: "/", mode: os.ModeDir | 0555}
+	return m
+}
+
+// cleanName return the name in fs, ok is false if the name is not under dir
+func (m *memFS) cleanName(name string) (string, bool) {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if m.dir != "" {
+		if name != m.dir && !strings.HasPrefix(name, m.dir+"/") {
+			return "", false
+		}
+		name = strings.TrimPrefix(strings.TrimPrefix(name, m.dir), "/")
+	}
+	return "/" + name, true
+}
+
+func (m *memFS) mkdirAll(name string, modTime time.Time) *memEntry {
+	if e, ok := m.entries[name]; ok {
+		return e
+	}
+	parent := m.mkdirAll(path.Dir(name), modTime)
+	e := &memEntry{name: name, mode: os.ModeDir | 0555, modTime: modTime}
+	parent.children = append(parent.children, e)
+	m.entries[name] = e
+	return e
+}
+
+func (m *memFS) add(name string, data []byte, isDir bool, modTime time.Time) {
+	name, ok := m.cleanName(name)
+	if !ok {
+		return
+	}
+	if isDir {
+		m.mkdirAll(name, modTime).modTime = modTime
+		return
+	}
+	if name == "/" {
+		return
+	}
+	if e, ok := m.entries[name]; ok {
+		if !e.IsDir() {
+			e.data, e.modTime, e.etag = data, modTime, contentETag(data)
+		}
+		return
+	}
+	parent := m.mkdirAll(path.Dir(name), modTime)
+	e := &memEntry{name: name, data: data, mode: 0444, modTime: modTime, etag: contentETag(data)}
+	parent.children = append(parent.children, e)
+	m.entries[name] = e
+}
+
+func (m *memFS) sortChildren() {
+	for _, e := range m.entries {
+		children := e.children
+		sort.Slice(children, func(i, j int) bool { return children[i].name < children[j].name })
+	}
+}
+
+// Open ...
+func (m *memFS) Open(name string) (http.File, error) {
+	name = path.Clean("/" + name)
+	e, ok := m.entries[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return &memFile{memEntry: e, Reader: bytes.NewReader(e.data)}, nil
+}
+
+type memFile struct {
+	*memEntry
+	*bytes.Reader
+	dirOffset int
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	return f.memEntry, nil
+}
+
+func (f *memFile) Readdir(count int) ([]os.FileInfo, error) {
+	if !f.IsDir() {
+		return nil, &os.PathError{Op: "readdir", Path: f.name, Err: errors.New("not a directory")}
+	}
+	rest := f.children[f.dirOffset:]
+	if count > 0 {
+		if len(rest) == 0 {
+			return nil, io.EOF
+		}
+		if len(rest) > count {
+			rest = rest[:count]
+		}
+	}
+	f.dirOffset += len(rest)
+	infos := make([]os.FileInfo, len(rest))
+	for i, e := range rest {
+		infos[i] = e
+	}
+	return infos, nil
+}
+
+// NewZipFS load the files under dir of a zip archive into memory
+func NewZipFS(zipPath, dir string) (http.FileSystem, error) {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	m := newMemFS(dir)
+	for _, zf := range zr.File {
+		if zf.FileInfo().IsDir() {
+			m.add(zf.Name, nil, true, zf.Modified)
+			continue
+		}
+		if !zf.Mode().IsRegular() {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read %v of %v failed:%v", zf.Name, zipPath, err)
+		}
+		m.add(zf.Name, data, false, zf.Modified)
+	}
+	m.sortChildren()
+	return m, nil
+}
+
+// NewTarGzFS load the files under dir of a tar.gz archive into memory
+func NewTarGzFS(tgzPath, dir string) (http.FileSystem, error) {
+	f, err := os.Open(tgzPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	m := newMemFS(dir)
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			m.add(hdr.Name, nil, true, hdr.ModTime)
+		case tar.TypeReg:
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return nil, fmt.Errorf("read %v of %v failed:%v", hdr.Name, tgzPath, err)
+			}
+			m.add(hdr.Name, data, false, hdr.ModTime)
+		}
+	}
+	m.sortChildren()
+	return m, nil
+}
+
+// NewArchiveFS load a .zip, .tar.gz or .tgz archive by its extension
+func NewArchiveFS(archivePath, dir string) (http.FileSystem, error) {
+	lower := strings.ToLower(archivePath)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return NewZipFS(archivePath, dir)
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return NewTarGzFS(archivePath, dir)
+	}
+	return nil, fmt.Errorf("unsupported archive %v", archivePath)
+}
+
+// SwapFS is a file system which can be replaced at runtime, the requests
+// in progress keep the files opened from the old one
+type SwapFS struct {
+	current atomic.Value
+}
+
+type swapFSHolder struct {
+	fs http.FileSystem
+}
+
+// NewSwapFS ...
+func NewSwapFS(fsys http.FileSystem) *SwapFS {
+	s := &SwapFS{}
+	s.Swap(fsys)
+	return s
+}
+
+// Open ...
+func (s *SwapFS) Open(name string) (http.File, error) {
+	return s.FileSystem().Open(name)
+}
+
+// FileSystem return the current file system
+func (s *SwapFS) FileSystem() http.FileSystem {
+	return s.current.Load().(swapFSHolder).fs
+}
+
+// Swap replace the current file system and return the old one
+func (s *SwapFS) Swap(fsys http.FileSystem) http.FileSystem {
+	if old, ok := s.current.Swap(swapFSHolder{fs: fsys}).(swapFSHolder); ok {
+		return old.fs
+	}
+	return nil
+}
+
+// LoadArchive load the archive fully and then swap to it, the current file
+// system is kept if loading failed
+func (s *SwapFS) LoadArchive(archivePath, dir string) error {
+	fsys, err := NewArchiveFS(archivePath, dir)
+	if err != nil {
+		return err
+	}
+	s.Swap(fsys)
+	return nil
+}
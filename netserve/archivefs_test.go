@@ -0,0 +1,170 @@
+package netserve
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+var archiveFiles = map[string]string{
+	"site/index.html":  "<html>index</html>",
+	"site/js/app.js":   "console.log(1)",
+	"other/secret.txt": "secret",
+}
+
+func sortedNames(files map[string]string) []string {
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range sortedNames(files) {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(files[name]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarGzArchive(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	tw.WriteHeader(&tar.Header{Name: "site/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: time.Now()})
+	for _, name := range sortedNames(files) {
+		tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644,
+			Size: int64(len(files[name])), ModTime: time.Now()})
+		tw.Write([]byte(files[name]))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	gw.Close()
+	return buf.Bytes()
+}
+
+func writeArchive(t *testing.T, name string, data []byte) string {
+	p := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(p, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func serveGet(h http.Handler, path string, header map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestArchiveFS(t *testing.T) {
+	for _, archive := range []string{
+		writeArchive(t, "site.zip", zipArchive(t, archiveFiles)),
+		writeArchive(t, "site.tar.gz", tarGzArchive(t, archiveFiles)),
+	} {
+		fsys, err := NewArchiveFS(archive, "site")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fs := NewFileServer(fsys, FileServerConfig{})
+		for path, body := range map[string]string{
+			"/":          "<html>index</html>",
+			"/js/app.js": "console.log(1)",
+		} {
+			w := serveGet(fs, path, nil)
+			if w.Code != http.StatusOK || w.Body.String() != body {
+				t.Errorf("%v %v got %v %v", archive, path, w.Code, w.Body.String())
+			}
+			etag := w.Header().Get("ETag")
+			if etag == "" || etag[0] == 'W' {
+				t.Errorf("%v %v got etag %v", archive, path, etag)
+			}
+			if w = serveGet(fs, path, map[string]string{"If-None-Match": etag}); w.Code != http.StatusNotModified {
+				t.Errorf("%v %v etag not matched %v", archive, path, w.Code)
+			}
+		}
+		for _, path := range []string{"/other/secret.txt", "/../other/secret.txt", "/none.js"} {
+			if w := serveGet(fs, path, nil); w.Code != http.StatusNotFound {
+				t.Errorf("%v %v got %v", archive, path, w.Code)
+			}
+		}
+	}
+
+	if _, err := NewArchiveFS(writeArchive(t, "site.rar", nil), ""); err == nil {
+		t.Error("expect unsupported archive error")
+	}
+}
+
+func TestSwapFS(t *testing.T) {
+	v1, err := NewZipFS(writeArchive(t, "v1.zip", zipArchive(t, map[string]string{"v.txt": "version 1"})), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := NewTarGzFS(writeArchive(t, "v2.tgz", tarGzArchive(t, map[string]string{"v.txt": "version 2"})), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	swap := NewSwapFS(v1)
+	fs := NewFileServer(swap, FileServerConfig{})
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				w := serveGet(fs, "/v.txt", nil)
+				if body := w.Body.String(); body != "version 1" && body != "version 2" {
+					t.Errorf("got %v %v", w.Code, body)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 200; i++ {
+		if i%2 == 0 {
+			swap.Swap(v2)
+		} else {
+			swap.Swap(v1)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	if err := swap.LoadArchive(writeArchive(t, "bad.zip", []byte("bad")), ""); err == nil {
+		t.Error("expect load error")
+	}
+	if w := serveGet(fs, "/v.txt", nil); w.Body.String() != "version 1" {
+		t.Errorf("failed load should keep current fs, got %v", w.Body.String())
+	}
+}
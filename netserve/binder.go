@@ -0,0 +1,390 @@
+package netserve
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asmexie/mux"
+)
+
+const maxBindMemory = 32 << 20
+
+// FieldError ...
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// BindErrors is the list of field errors returned by Bind, it's replied as
+// 400 with the list in data by WriteError
+type BindErrors []*FieldError
+
+func (errs BindErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// HTTPError ...
+func (errs BindErrors) HTTPError() *HTTPError {
+	return &HTTPError{Status: http.StatusBadRequest, Message: errs.Error(), Detail: errs, Err: errs}
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	regexpCache  sync.Map
+)
+
+type binder struct {
+	values url.Values
+	errs   BindErrors
+}
+
+func (b *binder) addError(field, rule, format string, v ...interface{}) {
+	b.errs = append(b.errs, &FieldError{Field: field, Rule: rule, Message: fmt.Sprintf(format, v...)})
+}
+
+// Bind fill the struct v from the json body, query, form and path vars of
+// request, the later one overrides the former. The field name is from tag
+// webvar or json, or the field name, and nested structs use "parent.child".
+// Tags:
+//
+//	default:"1"        set when the field is zero after binding
+//	layout:"2006-01-02" time layout, RFC3339 and unix seconds are accepted by default
+//	validate:"required,min=1,max=10,regex=^[a-z]+$"
+//
+// min and max check the value of numbers and the length of strings and
+// slices, regex must be the last rule. The field errors are returned as
+// BindErrors.
+func Bind(r *http.Request, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("bind target must be pointer to struct, got %T", v)
+	}
+	b := &binder{values: url.Values{}}
+
+	ctype, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case ctype == "application/json" && r.Body != nil && r.Body != http.NoBody:
+		if err := json.NewDecoder(r.Body).Decode(v); err != nil && err != io.EOF {
+			return BindErrors{{Field: "body", Rule: "json", Message: err.Error()}}
+		}
+	case ctype == "multipart/form-data":
+		if err := r.ParseMultipartForm(maxBindMemory); err != nil {
+			return BindErrors{{Field: "body", Rule: "form", Message: err.Error()}}
+		}
+	default:
+		if err := r.ParseForm(); err != nil {
+			return BindErrors{{Field: "body", Rule: "form", Message: err.Error()}}
+		}
+	}
+	for k, vs := range r.URL.Query() {
+		b.values[k] = vs
+	}
+	for k, vs := range r.PostForm {
+		b.values[k] = vs
+	}
+	for k, s := range mux.Vars(r) {
+		b.values[k] = []string{s}
+	}
+
+	b.bindStruct(rv.Elem(), "")
+	if len(b.errs) > 0 {
+		return b.errs
+	}
+	return nil
+}
+
+// Bind ...
+func (s *WebServe) Bind(r *http.Request, v interface{}) error {
+	return Bind(r, v)
+}
+
+func fieldName(ft reflect.StructField) string {
+	if name := ft.Tag.Get("webvar"); name != "" {
+		return name
+	}
+	if name := strings.Split(ft.Tag.Get("json"), ",")[0]; name != "" {
+		return name
+	}
+	return ft.Name
+}
+
+func (b *binder) hasPrefix(prefix string) bool {
+	for k := range b.values {
+		if strings.HasPrefix(k, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *binder) bindStruct(v reflect.Value, prefix string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		ft := t.Field(i)
+		if ft.PkgPath != "" && !ft.Anonymous {
+			continue
+		}
+		if ft.Tag.Get("webvar") == "-" || (ft.Tag.Get("webvar") == "" && ft.Tag.Get("json") == "-") {
+			continue
+		}
+		fv := v.Field(i)
+		name := prefix + fieldName(ft)
+
+		st := ft.Type
+		if st.Kind() == reflect.Ptr {
+			st = st.Elem()
+		}
+		if st.Kind() == reflect.Struct && st != timeType && !implementsTextUnmarshaler(st) {
+			nestedPrefix := name + "."
+			if ft.Anonymous && ft.Tag.Get("webvar") == "" && ft.Tag.Get("json") == "" {
+				nestedPrefix = prefix
+			}
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					if !b.hasPrefix(nestedPrefix) {
+						b.validate(name, ft, fv)
+						continue
+					}
+					fv.Set(reflect.New(st))
+				}
+				b.bindStruct(fv.Elem(), nestedPrefix)
+			} else if fv.CanSet() {
+				b.bindStruct(fv, nestedPrefix)
+			}
+			continue
+		}
+		if !fv.CanSet() {
+			continue
+		}
+
+		vals, set := b.values[name]
+		if set && len(vals) > 0 {
+			if err := setField(fv, vals, ft.Tag.Get("layout")); err != nil {
+				b.addError(name, "type", "invalid value %q: %v", vals[0], err)
+				continue
+			}
+		} else if def, ok := ft.Tag.Lookup("default"); ok && fv.IsZero() {
+			if err := setField(fv, []string{def}, ft.Tag.Get("layout")); err != nil {
+				b.addError(name, "default", "invalid default %q: %v", def, err)
+				continue
+			}
+		}
+		b.validate(name, ft, fv)
+	}
+}
+
+func implementsTextUnmarshaler(t reflect.Type) bool {
+	return reflect.PtrTo(t).Implements(reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem())
+}
+
+func setField(fv reflect.Value, vals []string, layout string) error {
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		fv = fv.Elem()
+	}
+	if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+		if len(vals) == 1 {
+			vals = strings.Split(vals[0], ",")
+		}
+		slice := reflect.MakeSlice(fv.Type(), len(vals), len(vals))
+		for i, s := range vals {
+			if err := setScalar(slice.Index(i), strings.TrimSpace(s), layout); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	}
+	return setScalar(fv, vals[0], layout)
+}
+
+func parseTime(s, layout string) (time.Time, error) {
+	if layout != "" {
+		return time.ParseInLocation(layout, s, time.Local)
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	sec, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("not RFC3339 or unix time")
+	}
+	return time.Unix(sec, 0), nil
+}
+
+func setScalar(fv reflect.Value, s string, layout string) error {
+	switch fv.Type() {
+	case timeType:
+		t, err := parseTime(s, layout)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(t))
+		return nil
+	case durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			sec, e := strconv.ParseFloat(s, 64)
+			if e != nil {
+				return err
+			}
+			d = time.Duration(sec * float64(time.Second))
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+	if fv.CanAddr() {
+		if u, ok := fv.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return u.UnmarshalText([]byte(s))
+		}
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(v)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(v)
+	case reflect.Float32, reflect.Float64:
+		v, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(v)
+	case reflect.Slice:
+		// []byte
+		fv.SetBytes([]byte(s))
+	default:
+		return fmt.Errorf("not support kind %v", fv.Kind())
+	}
+	return nil
+}
+
+func compileRegexp(expr string) (*regexp.Regexp, error) {
+	if v, ok := regexpCache.Load(expr); ok {
+		return v.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	regexpCache.Store(expr, re)
+	return re, nil
+}
+
+// measure return the number to compare with min and max
+func measure(fv reflect.Value) (float64, bool) {
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(fv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(fv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return fv.Float(), true
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return float64(fv.Len()), true
+	}
+	return 0, false
+}
+
+func (b *binder) validate(name string, ft reflect.StructField, fv reflect.Value) {
+	rules := ft.Tag.Get("validate")
+	if rules == "" {
+		return
+	}
+	var regexRule string
+	if i := strings.Index(rules, "regex="); i >= 0 {
+		regexRule, rules = rules[i+len("regex="):], rules[:i]
+	}
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			if strings.Contains(","+rules+",", ",required,") {
+				b.addError(name, "required", "is required")
+			}
+			return
+		}
+		fv = fv.Elem()
+	}
+
+	for _, rule := range strings.Split(rules, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		key, arg := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			key, arg = rule[:i], rule[i+1:]
+		}
+		switch key {
+		case "required":
+			if fv.IsZero() {
+				b.addError(name, "required", "is required")
+				return
+			}
+		case "min", "max":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				b.addError(name, key, "invalid rule %v", rule)
+				continue
+			}
+			n, ok := measure(fv)
+			if !ok {
+				continue
+			}
+			if key == "min" && n < limit {
+				b.addError(name, key, "must be at least %v", arg)
+			} else if key == "max" && n > limit {
+				b.addError(name, key, "must be at most %v", arg)
+			}
+		default:
+			b.addError(name, key, "unknown rule %v", rule)
+		}
+	}
+
+	if regexRule != "" && fv.Kind() == reflect.String && fv.Len() > 0 {
+		re, err := compileRegexp(regexRule)
+		if err != nil {
+			b.addError(name, "regex", "invalid regex %v", regexRule)
+		} else if !re.MatchString(fv.String()) {
+			b.addError(name, "regex", "does not match %v", regexRule)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package netserve
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testBindPage struct {
+	Page int `webvar:"page" default:"1" validate:"min=1"`
+	Size uint `webvar:"size" default:"20" validate:"max=100"`
+}
+
+type testBindReq struct {
+	Name    string        `json:"name" validate:"required,min=2,regex=^[a-z]+$"`
+	Tags    []string      `webvar:"tags"`
+	Active  bool          `webvar:"active"`
+	Since   time.Time     `webvar:"since" layout:"2006-01-02"`
+	Timeout time.Duration `webvar:"timeout"`
+	Paging  testBindPage  `webvar:"paging"`
+}
+
+func TestBind(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost,
+		"/users?tags=a,b&active=true&since=2020-01-02&timeout=1.5&paging.size=50",
+		strings.NewReader(`{"name":"gopub"}`))
+	r.Header.Set("Content-Type", "application/json")
+	var req testBindReq
+	if err := Bind(r, &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Name != "gopub" || len(req.Tags) != 2 || !req.Active || req.Since.Day() != 2 ||
+		req.Timeout != 1500*time.Millisecond || req.Paging.Page != 1 || req.Paging.Size != 50 {
+		t.Fatalf("bind result %+v", req)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/users?name=A1&paging.page=0&paging.size=x", nil)
+	req = testBindReq{}
+	err := Bind(r, &req)
+	var errs BindErrors
+	if !errors.As(err, &errs) || len(errs) != 3 {
+		t.Fatalf("bind errors %v", err)
+	}
+	rules := map[string]string{}
+	for _, e := range errs {
+		rules[e.Field] = e.Rule
+	}
+	if rules["name"] != "regex" || rules["paging.page"] != "min" || rules["paging.size"] != "type" {
+		t.Fatalf("bind errors %v", rules)
+	}
+}
@@ -0,0 +1,426 @@
+package netserve
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Binary layout of a struct is described by `bin` field tags, all numbers
+// are little endian and int/uint without fixed size are not supported:
+//
+//	`bin:"-"`        skip the field
+//	`bin:"len=N"`    string, []byte or slice with N(1,2,4) bytes length prefix, default 2
+//	`bin:"size=N"`   string or []byte with fixed N bytes, zero padded
+//	`bin:"rest"`     string or []byte taking the remaining data, must be the last field
+//	`bin:"version"`  unsigned field holding the layout version of the following fields
+//	`bin:"since=V"`  field only exists when layout version >= V
+//	`bin:"until=V"`  field only exists when layout version <= V
+//
+// Tag options can be combined with ',', e.g. `bin:"len=1,since=2"`.
+
+// ErrBinaryShort ...
+var ErrBinaryShort = errors.New("binary data too short")
+
+type binTag struct {
+	skip    bool
+	rest    bool
+	version bool
+	lenSize int
+	size    int
+	since   int
+	until   int
+}
+
+func parseBinTag(tag string) (bt binTag, err error) {
+	bt.lenSize = 2
+	bt.until = math.MaxInt32
+	if tag == "-" {
+		bt.skip = true
+		return
+	}
+	for _, opt := range strings.Split(tag, ",") {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			continue
+		}
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) == 1 {
+			switch kv[0] {
+			case "rest":
+				bt.rest = true
+			case "version":
+				bt.version = true
+			default:
+				return bt, fmt.Errorf("not support bin tag %s", opt)
+			}
+			continue
+		}
+		n, err := strconv.Atoi(kv[1])
+		if err != nil {
+			return bt, fmt.Errorf("bin tag %s value error:%v", opt, err)
+		}
+		switch kv[0] {
+		case "len":
+			if n != 1 && n != 2 && n != 4 {
+				return bt, fmt.Errorf("bin tag %s length prefix must be 1, 2 or 4", opt)
+			}
+			bt.lenSize = n
+		case "size":
+			bt.size = n
+		case "since":
+			bt.since = n
+		case "until":
+			bt.until = n
+		default:
+			return bt, fmt.Errorf("not support bin tag %s", opt)
+		}
+	}
+	return
+}
+
+func (bt binTag) inVersion(version int) bool {
+	return version >= bt.since && version <= bt.until
+}
+
+func binStructValue(v interface{}, needPtr bool) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return rv, errors.New("binary layout value is nil")
+		}
+		rv = rv.Elem()
+	} else if needPtr {
+		return rv, fmt.Errorf("binary layout need pointer, got %T", v)
+	}
+	if rv.Kind() != reflect.Struct {
+		return rv, fmt.Errorf("binary layout only support struct type, got %T", v)
+	}
+	return rv, nil
+}
+
+// UnmarshalBinary decode little endian data into struct v with layout version 0
+func UnmarshalBinary(data []byte, v interface{}) error {
+	_, err := UnmarshalBinaryVersion(data, v, 0)
+	return err
+}
+
+// UnmarshalBinaryVersion decode data into struct v, return the used bytes
+func UnmarshalBinaryVersion(data []byte, v interface{}, version int) (int, error) {
+	rv, err := binStructValue(v, true)
+	if err != nil {
+		return 0, err
+	}
+	d := &binDecoder{buf: data, version: version}
+	err = d.decodeStruct(rv)
+	return d.off, err
+}
+
+// MarshalBinary encode struct v with layout version 0
+func MarshalBinary(v interface{}) ([]byte, error) {
+	return MarshalBinaryVersion(v, 0)
+}
+
+// MarshalBinaryVersion ...
+func MarshalBinaryVersion(v interface{}, version int) ([]byte, error) {
+	rv, err := binStructValue(v, false)
+	if err != nil {
+		return nil, err
+	}
+	e := &binEncoder{version: version}
+	if err = e.encodeStruct(rv); err != nil {
+		return nil, err
+	}
+	return e.buf.Bytes(), nil
+}
+
+// WriteBinary encode v and write it to conn as reply
+func WriteBinary(conn SimpleNetConn, v interface{}) error {
+	data, err := MarshalBinary(v)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write(data)
+	return err
+}
+
+type binDecoder struct {
+	buf     []byte
+	off     int
+	version int
+}
+
+func (d *binDecoder) remain() int {
+	return len(d.buf) - d.off
+}
+
+func (d *binDecoder) take(name string, n int) ([]byte, error) {
+	if n < 0 || d.remain() < n {
+		return nil, fmt.Errorf("%w: field %s need %d bytes, remain %d", ErrBinaryShort, name, n, d.remain())
+	}
+	p := d.buf[d.off : d.off+n]
+	d.off += n
+	return p, nil
+}
+
+func (d *binDecoder) readLen(name string, lenSize int) (int, error) {
+	p, err := d.take(name, lenSize)
+	if err != nil {
+		return 0, err
+	}
+	switch lenSize {
+	case 1:
+		return int(p[0]), nil
+	case 2:
+		return int(binary.LittleEndian.Uint16(p)), nil
+	default:
+		return int(binary.LittleEndian.Uint32(p)), nil
+	}
+}
+
+func (d *binDecoder) decodeStruct(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		bt, err := parseBinTag(field.Tag.Get("bin"))
+		if err != nil {
+			return fmt.Errorf("field %s:%v", field.Name, err)
+		}
+		if bt.skip || !bt.inVersion(d.version) {
+			continue
+		}
+		fv := v.Field(i)
+		if err = d.decodeValue(field.Name, bt, fv); err != nil {
+			return err
+		}
+		if bt.version {
+			switch fv.Kind() {
+			case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				d.version = int(fv.Uint())
+			default:
+				return fmt.Errorf("version field %s must be unsigned", field.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func (d *binDecoder) decodeBytes(name string, bt binTag) ([]byte, error) {
+	switch {
+	case bt.rest:
+		return d.take(name, d.remain())
+	case bt.size > 0:
+		return d.take(name, bt.size)
+	default:
+		n, err := d.readLen(name, bt.lenSize)
+		if err != nil {
+			return nil, err
+		}
+		return d.take(name, n)
+	}
+}
+
+func (d *binDecoder) decodeValue(name string, bt binTag, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Bool:
+		p, err := d.take(name, 1)
+		if err != nil {
+			return err
+		}
+		v.SetBool(p[0] != 0)
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		p, err := d.take(name, int(v.Type().Size()))
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(leUint(p)<<(64-8*uint(len(p)))) >> (64 - 8*uint(len(p))))
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		p, err := d.take(name, int(v.Type().Size()))
+		if err != nil {
+			return err
+		}
+		v.SetUint(leUint(p))
+	case reflect.Float32:
+		p, err := d.take(name, 4)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(p))))
+	case reflect.Float64:
+		p, err := d.take(name, 8)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(math.Float64frombits(binary.LittleEndian.Uint64(p)))
+	case reflect.String:
+		p, err := d.decodeBytes(name, bt)
+		if err != nil {
+			return err
+		}
+		if bt.size > 0 {
+			p = bytes.TrimRight(p, "\x00")
+		}
+		v.SetString(string(p))
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := d.decodeValue(name, binTag{lenSize: bt.lenSize}, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			p, err := d.decodeBytes(name, bt)
+			if err != nil {
+				return err
+			}
+			v.SetBytes(append([]byte{}, p...))
+			return nil
+		}
+		n, err := d.readLen(name, bt.lenSize)
+		if err != nil {
+			return err
+		}
+		if n > d.remain() {
+			return fmt.Errorf("%w: field %s count %d, remain %d", ErrBinaryShort, name, n, d.remain())
+		}
+		s := reflect.MakeSlice(v.Type(), n, n)
+		for i := 0; i < n; i++ {
+			if err = d.decodeValue(name, binTag{lenSize: bt.lenSize}, s.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+	case reflect.Struct:
+		return d.decodeStruct(v)
+	default:
+		return fmt.Errorf("field %s kind %v is not fixed size", name, v.Kind())
+	}
+	return nil
+}
+
+func leUint(p []byte) (n uint64) {
+	for i := len(p) - 1; i >= 0; i-- {
+		n = n<<8 | uint64(p[i])
+	}
+	return
+}
+
+type binEncoder struct {
+	buf     bytes.Buffer
+	version int
+}
+
+func (e *binEncoder) writeUint(n uint64, size int) {
+	for i := 0; i < size; i++ {
+		e.buf.WriteByte(byte(n >> (8 * uint(i))))
+	}
+}
+
+func (e *binEncoder) writeLen(name string, n, lenSize int) error {
+	if lenSize < 4 && n >= 1<<(8*uint(lenSize)) {
+		return fmt.Errorf("field %s length %d exceed %d bytes prefix", name, n, lenSize)
+	}
+	e.writeUint(uint64(n), lenSize)
+	return nil
+}
+
+func (e *binEncoder) encodeStruct(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		bt, err := parseBinTag(field.Tag.Get("bin"))
+		if err != nil {
+			return fmt.Errorf("field %s:%v", field.Name, err)
+		}
+		if bt.skip || !bt.inVersion(e.version) {
+			continue
+		}
+		fv := v.Field(i)
+		if err = e.encodeValue(field.Name, bt, fv); err != nil {
+			return err
+		}
+		if bt.version {
+			switch fv.Kind() {
+			case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				e.version = int(fv.Uint())
+			default:
+				return fmt.Errorf("version field %s must be unsigned", field.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func (e *binEncoder) encodeBytes(name string, bt binTag, p []byte) error {
+	switch {
+	case bt.rest:
+	case bt.size > 0:
+		if len(p) > bt.size {
+			return fmt.Errorf("field %s length %d exceed size %d", name, len(p), bt.size)
+		}
+		e.buf.Write(p)
+		e.buf.Write(make([]byte, bt.size-len(p)))
+		return nil
+	default:
+		if err := e.writeLen(name, len(p), bt.lenSize); err != nil {
+			return err
+		}
+	}
+	e.buf.Write(p)
+	return nil
+}
+
+func (e *binEncoder) encodeValue(name string, bt binTag, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf.WriteByte(1)
+		} else {
+			e.buf.WriteByte(0)
+		}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.writeUint(uint64(v.Int()), int(v.Type().Size()))
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		e.writeUint(v.Uint(), int(v.Type().Size()))
+	case reflect.Float32:
+		e.writeUint(uint64(math.Float32bits(float32(v.Float()))), 4)
+	case reflect.Float64:
+		e.writeUint(math.Float64bits(v.Float()), 8)
+	case reflect.String:
+		return e.encodeBytes(name, bt, []byte(v.String()))
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encodeValue(name, binTag{lenSize: bt.lenSize}, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return e.encodeBytes(name, bt, v.Bytes())
+		}
+		if err := e.writeLen(name, v.Len(), bt.lenSize); err != nil {
+			return err
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encodeValue(name, binTag{lenSize: bt.lenSize}, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		return e.encodeStruct(v)
+	default:
+		return fmt.Errorf("field %s kind %v is not fixed size", name, v.Kind())
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package netserve
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type testBinItem struct {
+	ID    int16
+	Flags [2]uint8
+}
+
+type testBinReq struct {
+	Version uint8 `bin:"version"`
+	UserID  int32
+	Name    string `bin:"len=1"`
+	Country string `bin:"size=4"`
+	Items   []testBinItem
+	Score   float32 `bin:"since=2"`
+	Extra   []byte  `bin:"rest"`
+}
+
+func TestBinaryLayout(t *testing.T) {
+	req := testBinReq{Version: 2, UserID: -7, Name: "gopub", Country: "cn",
+		Items: []testBinItem{{ID: -1, Flags: [2]uint8{1, 2}}}, Score: 1.5, Extra: []byte{9, 9}}
+	data, err := MarshalBinary(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rs testBinReq
+	if err = UnmarshalBinary(data, &rs); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(req, rs) {
+		t.Fatalf("binary layout round trip failed %+v", rs)
+	}
+
+	if err = UnmarshalBinary(data[:6], &rs); !errors.Is(err, ErrBinaryShort) {
+		t.Fatalf("short data error expected, got %v", err)
+	}
+	if _, _, err = (&mtpdecoder{}).Decode([]byte{1}); !errors.Is(err, ErrBinaryShort) {
+		t.Fatalf("short mt packet error expected, got %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package netserve
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/asmexie/gopub/common"
+	"github.com/asmexie/go-logger/logger"
+)
+
+const (
+	defaultCertCheckInterval = time.Minute
+	defaultCertExpireWarn    = 14 * 24 * time.Hour
+)
+
+// CertPair ...
+type CertPair struct {
+	CertPath string
+	KeyPath  string
+}
+
+type loadedCert struct {
+	CertPair
+	cert        *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+func fileModTime(path string) (time.Time, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+func (lc *loadedCert) changed() bool {
+	certTime, err := fileModTime(lc.CertPath)
+	if err != nil {
+		return false
+	}
+	keyTime, err := fileModTime(lc.KeyPath)
+	if err != nil {
+		return false
+	}
+	return !certTime.Equal(lc.certModTime) || !keyTime.Equal(lc.keyModTime)
+}
+
+func (lc *loadedCert) load() error {
+	certTime, err := fileModTime(lc.CertPath)
+	if err != nil {
+		return err
+	}
+	keyTime, err := fileModTime(lc.KeyPath)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(lc.CertPath, lc.KeyPath)
+	if err != nil {
+		return err
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return err
+		}
+	}
+	lc.cert = &cert
+	lc.certModTime = certTime
+	lc.keyModTime = keyTime
+	return nil
+}
+
+// CertManager serve tls certificates selected by SNI, the certificate files
+// are polled and reloaded when changed
+type CertManager struct {
+	certs  []*loadedCert
+	locker sync.RWMutex
+	// reloadLocker serialize Reload, it's the only writer of certs
+	reloadLocker sync.Mutex
+	ExpireWarn   time.Duration
+}
+
+// NewCertManager load all cert pairs, the first pair is the default one
+func NewCertManager(pairs []CertPair) (*CertManager, error) {
+	if len(pairs) == 0 {
+		return nil, errors.New("no certificate configured")
+	}
+	m := &CertManager{ExpireWarn: defaultCertExpireWarn}
+	for _, pair := range pairs {
+		lc := &loadedCert{CertPair: pair}
+		if err := lc.load(); err != nil {
+			return nil, fmt.Errorf("load certificate %v failed:%v", pair.CertPath, err)
+		}
+		m.certs = append(m.certs, lc)
+	}
+	m.CheckExpire()
+	return m, nil
+}
+
+// GetCertificate is used as tls.Config.GetCertificate
+func (m *CertManager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.locker.RLock()
+	defer m.locker.RUnlock()
+	if hello.ServerName != "" {
+		for _, lc := range m.certs {
+			if lc.cert.Leaf.VerifyHostname(hello.ServerName) == nil {
+				return lc.cert, nil
+			}
+		}
+	}
+	return m.certs[0].cert, nil
+}
+
+// TLSConfig ...
+func (m *CertManager) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: m.GetCertificate,
+	}
+}
+
+// Reload load the changed certificates, the old one is kept if loading failed
+func (m *CertManager) Reload() (err error) {
+	m.reloadLocker.Lock()
+	defer m.reloadLocker.Unlock()
+	for i, lc := range m.certs {
+		if !lc.changed() {
+			continue
+		}
+		tmp := &loadedCert{CertPair: lc.CertPair}
+		if e := tmp.load(); e != nil {
+			// the cert and key may be written not at the same time, retry next time
+			err = fmt.Errorf("reload certificate %v failed:%v", lc.CertPath, e)
+			common.LogError(err)
+			continue
+		}
+		m.locker.Lock()
+		m.certs[i] = tmp
+		m.locker.Unlock()
+		logger.Infof("reloaded certificate %v expire at %v", lc.CertPath, tmp.cert.Leaf.NotAfter)
+	}
+	return
+}
+
+// CheckExpire log the certificates which will expire in ExpireWarn
+func (m *CertManager) CheckExpire() {
+	m.locker.RLock()
+	defer m.locker.RUnlock()
+	now := time.Now()
+	for _, lc := range m.certs {
+		notAfter := lc.cert.Leaf.NotAfter
+		if notAfter.Before(now) {
+			logger.Errorf("certificate %v expired at %v", lc.CertPath, notAfter)
+		} else if notAfter.Sub(now) < m.ExpireWarn {
+			logger.Errorf("certificate %v will expire at %v", lc.CertPath, notAfter)
+		}
+	}
+}
+
+// Watch poll the certificate files until ctx is done
+func (m *CertManager) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultCertCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastCheckExpire := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		m.Reload()
+		if time.Since(lastCheckExpire) > time.Hour {
+			lastCheckExpire = time.Now()
+			m.CheckExpire()
+		}
+	}
+}
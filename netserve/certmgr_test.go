@@ -0,0 +1,130 @@
+package netserve
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeHostCert write a self signed certificate of host to dir, the files are
+// dated at mtime so that the changes are seen in the same second
+func writeHostCert(t *testing.T, dir, host string, mtime time.Time) (CertPair, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair := CertPair{CertPath: filepath.Join(dir, host+".crt"), KeyPath: filepath.Join(dir, host+".key")}
+	writeCertFile(t, pair.CertPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), mtime)
+	writeCertFile(t, pair.KeyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), mtime)
+	return pair, der
+}
+
+func writeCertFile(t *testing.T, path string, data []byte, mtime time.Time) {
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func certOf(t *testing.T, m *CertManager, serverName string) []byte {
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Certificate[0]
+}
+
+func TestCertManagerSNI(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	pairA, certA := writeHostCert(t, dir, "a.example.com", now)
+	pairB, certB := writeHostCert(t, dir, "b.example.com", now)
+	m, err := NewCertManager([]CertPair{pairA, pairB})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, expect := range map[string][]byte{"a.example.com": certA, "b.example.com": certB, "c.example.com": certA, "": certA} {
+		if string(certOf(t, m, name)) != string(expect) {
+			t.Errorf("server name %q got the wrong certificate", name)
+		}
+	}
+
+	if _, err := NewCertManager(nil); err == nil {
+		t.Error("no certificate should fail")
+	}
+	if _, err := NewCertManager([]CertPair{{CertPath: pairA.CertPath, KeyPath: pairB.KeyPath}}); err == nil {
+		t.Error("mismatched pair should fail")
+	}
+}
+
+func TestCertManagerReload(t *testing.T) {
+	dir, newDir := t.TempDir(), t.TempDir()
+	now := time.Now()
+	pair, oldCert := writeHostCert(t, dir, "a.example.com", now.Add(-time.Minute))
+	m, err := NewCertManager([]CertPair{pair})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Reload(); err != nil || string(certOf(t, m, "a.example.com")) != string(oldCert) {
+		t.Fatalf("reload of unchanged files got %v", err)
+	}
+
+	// only the cert is written, the pair doesn't match and the old one is kept
+	newPair, newCert := writeHostCert(t, newDir, "a.example.com", now)
+	certPEM, _ := os.ReadFile(newPair.CertPath)
+	keyPEM, _ := os.ReadFile(newPair.KeyPath)
+	writeCertFile(t, pair.CertPath, certPEM, now)
+	if err := m.Reload(); err == nil {
+		t.Fatal("reload of half written pair should fail")
+	}
+	if string(certOf(t, m, "a.example.com")) != string(oldCert) {
+		t.Fatal("old certificate should be kept")
+	}
+
+	writeCertFile(t, pair.KeyPath, keyPEM, now)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := m.Reload(); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			certOf(t, m, "a.example.com")
+		}()
+	}
+	wg.Wait()
+	if string(certOf(t, m, "a.example.com")) != string(newCert) {
+		t.Fatal("certificate should be reloaded")
+	}
+}
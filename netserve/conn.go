@@ -57,18 +57,29 @@ func newConn(netconn RawNetConn, sg *ServeGroup, isTCP bool) (c *conn) {
 	if c.rsw, ok = netconn.(http.ResponseWriter); !ok {
 		c.rsw = nil
 	}
-	c.lr = io.LimitReader(netconn, noLimit).(*io.LimitedReader)
-	br := newBufioReader(c.lr)
-	bw := newBufioWriter(checkConnErrorWriter{c}, 4<<10)
-	c.buf = bufio.NewReadWriter(br, bw)
 	if isTCP {
 		c.context = NewNetContext(netconn.PeerAddr())
 	} else {
 		c.context = GetUdpNetContext(netconn.PeerAddr())
 	}
+	c.lr = io.LimitReader(countReader{netconn, c.context}, noLimit).(*io.LimitedReader)
+	br := newBufioReader(c.lr)
+	bw := newBufioWriter(checkConnErrorWriter{c}, 4<<10)
+	c.buf = bufio.NewReadWriter(br, bw)
 	return c
 }
 
+type countReader struct {
+	r       io.Reader
+	context *NetContext
+}
+
+func (r countReader) Read(p []byte) (n int, err error) {
+	n, err = r.r.Read(p)
+	r.context.recvBytes.Add(int64(n))
+	return
+}
+
 func (c *conn) PeerAddr() string {
 	return c.c.PeerAddr()
 }
@@ -108,6 +119,7 @@ func (c *conn) finalFlush() {
 }
 
 func (c *conn) Close() (err error) {
+	c.sg.untrackConn(c)
 	c.finalFlush()
 	if c.c != nil {
 		err = c.c.Close()
@@ -149,12 +161,19 @@ func (c *conn) HandleRequest() {
 		c.context.Verbosef("receive data is empty")
 		return
 	}
-	api, data, err := c.sg.d.Decode(rawData)
+	app, api, data, err := c.sg.decode(rawData)
 	if err != nil {
 		common.LogError(err)
 		return
 	}
-	c.context.Verbosef("recv ip %v api %v data:% x\n", c.c.PeerAddr(), api, data)
+	c.context.Verbosef("recv ip %v app %v api %v data:% x\n", c.c.PeerAddr(), app, api, data)
+	if !c.sg.limiter.Allow(app, api) {
+		c.context.Verbosef("app %v api %v is rate limited", app, api)
+		if h, ok := c.handler.(RateLimitedHandler); ok {
+			h.HandleRateLimited(c, app, api)
+		}
+		return
+	}
 	c.handler.HandleAPI(c, api, data)
 }
 
@@ -164,6 +183,7 @@ type checkConnErrorWriter struct {
 
 func (w checkConnErrorWriter) Write(p []byte) (n int, err error) {
 	n, err = w.c.c.Write(p) // c.w == c.rwc, except after a hijack, when rwc is nil.
+	w.c.context.sendBytes.Add(int64(n))
 	if err != nil && w.c.werr == nil {
 		w.c.werr = err
 	}
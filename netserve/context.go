@@ -4,6 +4,8 @@ import (
 	"crypto/md5"
 	"encoding/binary"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/asmexie/gopub/common"
@@ -13,8 +15,16 @@ import (
 
 // NetContext ...
 type NetContext struct {
+	// locker guard the cipher state, it's held by the cipher when decoding
+	// and encoding, so the goroutines pushing data and the one reading are
+	// serialized
+	locker     sync.Mutex
 	logVerbose bool
 	peerAdrr   string
+	peerHost   string
+	// verboseCache is gVerboseGen<<1 | verbose of peer
+	verboseCache atomic.Uint64
+
 	aeskey     []byte
 	recviv     []byte
 	sendiv     []byte
@@ -29,6 +39,11 @@ type NetContext struct {
 	size       int
 	packsize   int
 	ackSetChan chan uint32
+
+	acceptCompress byte
+	created        time.Time
+	recvBytes      atomic.Int64
+	sendBytes      atomic.Int64
 }
 
 var (
@@ -41,7 +56,12 @@ func init() {
 }
 
 func NewNetContext(peerAddr string) *NetContext {
-	return &NetContext{peerAdrr: peerAddr, ackSetChan: make(chan uint32, 1)}
+	return &NetContext{
+		peerAdrr:   peerAddr,
+		peerHost:   peerHost(peerAddr),
+		ackSetChan: make(chan uint32, 1),
+		created:    time.Now(),
+	}
 }
 
 func GetUdpNetContext(peerAddr string) (ctx *NetContext) {
@@ -66,14 +86,33 @@ func (context *NetContext) checkSetAck(ack uint32) (ok bool) {
 	return
 }
 
-func (context *NetContext) Verbose(s string) {
+// verbose cache the verbose of peer until SetVerbosePeer is called
+func (context *NetContext) verbose() bool {
 	if context.logVerbose {
+		return true
+	}
+	gen := atomic.LoadUint32(&gVerboseGen)
+	cached := context.verboseCache.Load()
+	if uint32(cached>>1) == gen {
+		return cached&1 == 1
+	}
+	_, ok := gVerbosePeers.Load(context.peerHost)
+	cached = uint64(gen) << 1
+	if ok {
+		cached |= 1
+	}
+	context.verboseCache.Store(cached)
+	return ok
+}
+
+func (context *NetContext) Verbose(s string) {
+	if context.verbose() {
 		logger.DebugN(1, s)
 	}
 }
 
 func (context *NetContext) Verbosef(format string, v ...interface{}) {
-	if context.logVerbose {
+	if context.verbose() {
 		logger.DebugN(1, fmt.Sprintf(format, v...))
 	}
 }
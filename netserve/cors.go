@@ -0,0 +1,187 @@
+package netserve
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/asmexie/gopub/common"
+	"github.com/asmexie/gopub/netutils"
+)
+
+var (
+	defaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	defaultCORSHeaders = []string{"Accept", "Content-Type", "X-Requested-With", netutils.HeaderRequestID}
+)
+
+// CORSConfig ...
+type CORSConfig struct {
+	// AllowOrigins like "https://example.com", "https://*.example.com" or "*"
+	AllowOrigins []string
+	// AllowMethods default GET, HEAD and POST
+	AllowMethods []string
+	// AllowHeaders are request headers allowed, "*" allow all requested headers
+	AllowHeaders []string
+	// ExposeHeaders are response headers the browser can read
+	ExposeHeaders []string
+	// AllowCredentials can't be used with "*" in AllowOrigins, the browsers
+	// reject it and reflecting the origin would let any site read credentials
+	AllowCredentials bool
+	// MaxAge of preflight result in seconds, no header is sent if it's 0
+	MaxAge int
+}
+
+// CORS answer preflight requests and add the CORS headers to responses
+type CORS struct {
+	config       CORSConfig
+	allowAll     bool
+	origins      []string
+	methods      string
+	headers      map[string]bool
+	allowHeaders bool
+}
+
+// NewCORS panic if "*" is allowed with credentials
+func NewCORS(config CORSConfig) *CORS {
+	c := &CORS{config: config, headers: map[string]bool{}}
+	for _, origin := range config.AllowOrigins {
+		if origin == "*" {
+			c.allowAll = true
+		}
+		c.origins = append(c.origins, strings.ToLower(origin))
+	}
+	if c.allowAll && config.AllowCredentials {
+		common.CheckError(errors.New("cors can't allow credentials for all origins"))
+	}
+	methods := config.AllowMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	c.methods = strings.ToUpper(strings.Join(methods, ", "))
+	headers := config.AllowHeaders
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+	for _, h := range headers {
+		if h == "*" {
+			c.allowHeaders = true
+		}
+		c.headers[http.CanonicalHeaderKey(h)] = true
+	}
+	return c
+}
+
+// matchOrigin match origin with pattern, * in pattern match one or more
+// chars in host, e.g. https://*.example.com match https://a.example.com
+func matchOrigin(pattern, origin string) bool {
+	i := strings.Index(pattern, "*")
+	if i < 0 {
+		return pattern == origin
+	}
+	prefix, suffix := pattern[:i], pattern[i+1:]
+	return len(origin) > len(prefix)+len(suffix) &&
+		strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix)
+}
+
+// AllowedOrigin ...
+func (c *CORS) AllowedOrigin(origin string) bool {
+	if c.allowAll {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	for _, pattern := range c.origins {
+		if matchOrigin(pattern, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CORS) allowedMethod(method string) bool {
+	method = strings.ToUpper(method)
+	for _, m := range strings.Split(c.methods, ", ") {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CORS) allowedHeaders(requested string) bool {
+	if c.allowHeaders {
+		return true
+	}
+	for _, h := range strings.Split(requested, ",") {
+		h = strings.TrimSpace(h)
+		if h != "" && !c.headers[http.CanonicalHeaderKey(h)] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *CORS) setOrigin(w http.ResponseWriter, origin string) {
+	header := w.Header()
+	header.Add("Vary", "Origin")
+	if c.allowAll {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if c.config.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c *CORS) preflight(w http.ResponseWriter, r *http.Request, origin string) {
+	header := w.Header()
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+	reqMethod := r.Header.Get("Access-Control-Request-Method")
+	reqHeaders := r.Header.Get("Access-Control-Request-Headers")
+	if !c.AllowedOrigin(origin) || !c.allowedMethod(reqMethod) || !c.allowedHeaders(reqHeaders) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	c.setOrigin(w, origin)
+	header.Set("Access-Control-Allow-Methods", c.methods)
+	if reqHeaders != "" {
+		header.Set("Access-Control-Allow-Headers", reqHeaders)
+	}
+	if c.config.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(c.config.MaxAge))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Handler wrap h with CORS, the preflight requests are answered without
+// calling h, so wrap the whole router to answer the routes which are
+// registered without OPTIONS method
+func (c *CORS) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			c.preflight(w, r, origin)
+			return
+		}
+		if c.AllowedOrigin(origin) {
+			c.setOrigin(w, origin)
+			if len(c.config.ExposeHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(c.config.ExposeHeaders, ", "))
+			}
+		} else {
+			w.Header().Add("Vary", "Origin")
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// CORS wrap f with the CORS config
+func (s *WebServe) CORS(f http.Handler, config CORSConfig) http.Handler {
+	return NewCORS(config).Handler(f)
+}
@@ -0,0 +1,68 @@
+package netserve
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	h := NewCORS(CORSConfig{
+		AllowOrigins:     []string{"https://*.example.com"},
+		AllowMethods:     []string{"GET", "PUT"},
+		AllowCredentials: true,
+		MaxAge:           600,
+	}).Handler(NoCache(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})))
+	serve := func(method, origin string, header map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/api", nil)
+		r.Header.Set("Origin", origin)
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve(http.MethodOptions, "https://app.example.com", map[string]string{
+		"Access-Control-Request-Method":  "PUT",
+		"Access-Control-Request-Headers": "content-type",
+	})
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		w.Header().Get("Access-Control-Max-Age") != "600" || w.Body.Len() != 0 {
+		t.Fatalf("preflight %v %v", w.Code, w.Header())
+	}
+	w = serve(http.MethodOptions, "https://app.example.com", map[string]string{"Access-Control-Request-Method": "DELETE"})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("method not allowed %v", w.Code)
+	}
+
+	w = serve(http.MethodGet, "https://app.example.com", nil)
+	if w.Body.String() != "ok" || w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Fatalf("simple request %v %v", w.Body.String(), w.Header())
+	}
+	w = serve(http.MethodGet, "https://example.com.evil.com", nil)
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("origin should not be allowed %v", w.Header())
+	}
+}
+
+func TestCORSAllowAll(t *testing.T) {
+	h := NewCORS(CORSConfig{AllowOrigins: []string{"*"}}).Handler(http.NotFoundHandler())
+	r := httptest.NewRequest(http.MethodGet, "/api", nil)
+	r.Header.Set("Origin", "https://evil.com")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" || w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Fatalf("allow all got %v", w.Header())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("credentials should not be allowed for all origins")
+		}
+	}()
+	NewCORS(CORSConfig{AllowOrigins: []string{"https://a.com", "*"}, AllowCredentials: true})
+}
@@ -0,0 +1,101 @@
+package netserve
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	rpprof "runtime/pprof"
+	"time"
+
+	"github.com/asmexie/gopub/netutils"
+	"github.com/asmexie/go-logger/logger"
+)
+
+var startTime = time.Now()
+
+// only loopback can access debug handlers when PprofIps is empty
+var defaultPprofIps = []string{"127.0.0.1", "::1"}
+
+// RuntimeStats ...
+type RuntimeStats struct {
+	Uptime       float64 `json:"uptime"`
+	Goroutines   int     `json:"goroutines"`
+	GOMAXPROCS   int     `json:"gomaxprocs"`
+	NumCPU       int     `json:"num_cpu"`
+	NumGC        uint32  `json:"num_gc"`
+	PauseTotalNs uint64  `json:"pause_total_ns"`
+	LastGC       int64   `json:"last_gc"`
+	HeapAlloc    uint64  `json:"heap_alloc"`
+	HeapSys      uint64  `json:"heap_sys"`
+	HeapObjects  uint64  `json:"heap_objects"`
+	TotalAlloc   uint64  `json:"total_alloc"`
+	Sys          uint64  `json:"sys"`
+}
+
+// ReadRuntimeStats ...
+func ReadRuntimeStats() RuntimeStats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return RuntimeStats{
+		Uptime:       time.Since(startTime).Seconds(),
+		Goroutines:   runtime.NumGoroutine(),
+		GOMAXPROCS:   runtime.GOMAXPROCS(0),
+		NumCPU:       runtime.NumCPU(),
+		NumGC:        ms.NumGC,
+		PauseTotalNs: ms.PauseTotalNs,
+		LastGC:       int64(ms.LastGC / uint64(time.Millisecond)),
+		HeapAlloc:    ms.HeapAlloc,
+		HeapSys:      ms.HeapSys,
+		HeapObjects:  ms.HeapObjects,
+		TotalAlloc:   ms.TotalAlloc,
+		Sys:          ms.Sys,
+	}
+}
+
+// OnlyPprofIps allow only the PprofIps of config to access h, the client ip
+// is resolved with TrustedProxies of config like ClientIP
+func (s *WebServe) OnlyPprofIps(h http.Handler) http.Handler {
+	ips := s.config.PprofIps
+	if len(ips) == 0 {
+		ips = defaultPprofIps
+	}
+	nets, err := netutils.ParseIPNetList(ips)
+	if err != nil {
+		logger.Error("parse pprof ips failed:", err)
+		nets = netutils.IPNetList{}
+	}
+	access := netutils.NewIPAccessWithNets(nets, nil, s.access.Trusted())
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// not found instead of forbidden, hide the debug handlers
+		if !access.AllowedRequest(r) {
+			http.NotFound(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// HandleDebug mount the debug handlers which only PprofIps can access:
+//
+//	/debug/pprof/       net/http/pprof
+//	/debug/vars         expvar
+//	/debug/runtime      goroutines, gc and memory stats
+//	/debug/goroutines   full goroutine stack dump
+func (s *WebServe) HandleDebug() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.Handle("/debug/runtime", s.NoCacheFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.WriteJSON(w, ReadRuntimeStats())
+	}))
+	mux.HandleFunc("/debug/goroutines", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		rpprof.Lookup("goroutine").WriteTo(w, 2)
+	})
+	s.PathPrefix("/debug/").Handler(s.OnlyPprofIps(mux))
+}
@@ -0,0 +1,38 @@
+package netserve
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOnlyPprofIps(t *testing.T) {
+	s := NewWebServe(&WebServeConfig{TrustedProxies: []string{"10.0.0.1"}})
+	s.HandleDebug()
+	cases := []struct {
+		remoteAddr string
+		header     string
+		value      string
+		status     int
+	}{
+		{"127.0.0.1:1000", "", "", http.StatusOK},
+		{"[::1]:1000", "", "", http.StatusOK},
+		{"8.8.8.8:1000", "X-Real-IP", "127.0.0.1", http.StatusNotFound},
+		{"8.8.8.8:1000", "X-Forwarded-For", "127.0.0.1", http.StatusNotFound},
+		{"10.0.0.1:1000", "", "", http.StatusNotFound},
+		{"10.0.0.1:1000", "X-Forwarded-For", "127.0.0.1", http.StatusOK},
+		{"10.0.0.1:1000", "X-Forwarded-For", "127.0.0.1, 8.8.8.8", http.StatusNotFound},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/debug/runtime", nil)
+		r.RemoteAddr = c.remoteAddr
+		if c.header != "" {
+			r.Header.Set(c.header, c.value)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		if w.Code != c.status {
+			t.Errorf("%+v got status %v", c, w.Code)
+		}
+	}
+}
@@ -1,22 +1,61 @@
 package netserve
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
+// CacheControlRule set Cache-Control of the files whose path matches Pattern,
+// the pattern is matched by path.Match with the url path, or with the base
+// name when it has no slash, e.g. {"/assets/*", "public, max-age=31536000, immutable"}
+type CacheControlRule struct {
+	Pattern string
+	Value   string
+}
+
+// FileServerConfig ...
+type FileServerConfig struct {
+	NotFoundHandler http.Handler
+	// Precompressed serve the .br or .gz sibling of file if client accept it
+	Precompressed bool
+	// CacheControls are checked in order, the first matched one is used
+	CacheControls []CacheControlRule
+	// ListDirectory render the directories without index.html
+	ListDirectory bool
+	// SPAFallback serve /index.html for the unknown routes without extension
+	SPAFallback bool
+}
+
 type fileHandler struct {
 	root            http.FileSystem
 	notfoundHandler http.Handler
+	config          FileServerConfig
+	etags           sync.Map
 }
 
 // FileServer ...
 func FileServer(root http.FileSystem, notfoundHandler http.Handler) http.Handler {
+	return NewFileServer(root, FileServerConfig{NotFoundHandler: notfoundHandler})
+}
+
+// NewFileServer ...
+func NewFileServer(root http.FileSystem, config FileServerConfig) http.Handler {
 	return &fileHandler{
 		root:            root,
-		notfoundHandler: notfoundHandler,
+		notfoundHandler: config.NotFoundHandler,
+		config:          config,
 	}
 }
 
@@ -50,6 +89,9 @@ func localRedirect(w http.ResponseWriter, r *http.Request, newPath string) {
 
 func (fh *fileHandler) writeHTTPFileErr(w http.ResponseWriter, r *http.Request, err error) {
 	msg, code := fh.toHTTPError(err)
+	if code == http.StatusNotFound && fh.isSPARoute(r) && fh.serveSPAIndex(w, r) {
+		return
+	}
 	if code == http.StatusNotFound && fh.notfoundHandler != nil {
 		fh.notfoundHandler.ServeHTTP(w, r)
 	} else {
@@ -123,9 +165,186 @@ func (fh *fileHandler) serveFile(w http.ResponseWriter, r *http.Request, fs http
 	}
 
 	if d.IsDir() {
+		if fh.config.ListDirectory {
+			fh.dirList(w, r, f)
+			return
+		}
 		fh.writeHTTPFileErr(w, r, os.ErrNotExist)
 		return
 	}
 
+	fh.serveContent(w, r, fs, name, d, f)
+}
+
+// precompressed encodings in order of preference
+var precompressedExts = []struct {
+	encoding string
+	ext      string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+func acceptEncoding(r *http.Request, encoding string) bool {
+	for _, v := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		v = strings.TrimSpace(v)
+		name, params := v, ""
+		if i := strings.Index(v, ";"); i >= 0 {
+			name, params = strings.TrimSpace(v[:i]), strings.TrimSpace(v[i+1:])
+		}
+		if !strings.EqualFold(name, encoding) && name != "*" {
+			continue
+		}
+		params = strings.Replace(params, " ", "", -1)
+		return params != "q=0" && params != "q=0.0" && params != "q=0.00" && params != "q=0.000"
+	}
+	return false
+}
+
+// openPrecompressed open the compressed sibling of name accepted by client
+func (fh *fileHandler) openPrecompressed(r *http.Request, fs http.FileSystem, name string) (string, http.File, os.FileInfo) {
+	if r.Header.Get("Range") != "" {
+		return "", nil, nil
+	}
+	for _, pc := range precompressedExts {
+		if !acceptEncoding(r, pc.encoding) {
+			continue
+		}
+		f, err := fs.Open(name + pc.ext)
+		if err != nil {
+			continue
+		}
+		d, err := f.Stat()
+		if err != nil || d.IsDir() {
+			f.Close()
+			continue
+		}
+		return pc.encoding, f, d
+	}
+	return "", nil, nil
+}
+
+func (fh *fileHandler) cacheControl(upath string) string {
+	for _, rule := range fh.config.CacheControls {
+		target := upath
+		if !strings.Contains(rule.Pattern, "/") {
+			target = path.Base(upath)
+		}
+		if ok, _ := path.Match(rule.Pattern, target); ok {
+			return rule.Value
+		}
+	}
+	return ""
+}
+
+type etagEntry struct {
+	modTime time.Time
+	size    int64
+	etag    string
+}
+
+// strongETag hash the content of file, the result is cached until the file
+// is changed, the file info can provide its own etag by an ETag method. Files
+// without ModTime (embed.FS, some archives) can't be checked for changes, so
+// they are hashed every time
+func (fh *fileHandler) strongETag(name string, d os.FileInfo, f http.File) (string, error) {
+	if et, ok := d.(interface{ ETag() string }); ok && et.ETag() != "" {
+		return et.ETag(), nil
+	}
+	cacheable := !d.ModTime().IsZero()
+	if v, ok := fh.etags.Load(name); ok && cacheable {
+		e := v.(*etagEntry)
+		if e.modTime.Equal(d.ModTime()) && e.size == d.Size() {
+			return e.etag, nil
+		}
+	}
+	h := sha1.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := `"` + hex.EncodeToString(h.Sum(nil)) + `"`
+	if cacheable {
+		fh.etags.Store(name, &etagEntry{modTime: d.ModTime(), size: d.Size(), etag: etag})
+	}
+	return etag, nil
+}
+
+func (fh *fileHandler) serveContent(w http.ResponseWriter, r *http.Request, fs http.FileSystem, name string, d os.FileInfo, f http.File) {
+	if fh.config.Precompressed {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if encoding, cf, cd := fh.openPrecompressed(r, fs, name); cf != nil {
+			defer cf.Close()
+			ctype := mime.TypeByExtension(path.Ext(name))
+			if ctype == "" {
+				ctype = "application/octet-stream"
+			}
+			w.Header().Set("Content-Type", ctype)
+			w.Header().Set("Content-Encoding", encoding)
+			name, d, f = name+path.Ext(cd.Name()), cd, cf
+		}
+	}
+	if cc := fh.cacheControl(r.URL.Path); cc != "" {
+		w.Header().Set("Cache-Control", cc)
+	}
+	if etag, err := fh.strongETag(name, d, f); err == nil {
+		w.Header().Set("ETag", etag)
+	} else {
+		fh.writeHTTPFileErr(w, r, err)
+		return
+	}
 	http.ServeContent(w, r, d.Name(), d.ModTime(), f)
 }
+
+func (fh *fileHandler) isSPARoute(r *http.Request) bool {
+	if !fh.config.SPAFallback || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return false
+	}
+	return path.Ext(r.URL.Path) == ""
+}
+
+// serveSPAIndex serve /index.html of root, it returns false if there is no index
+func (fh *fileHandler) serveSPAIndex(w http.ResponseWriter, r *http.Request) bool {
+	const indexName = "/index.html"
+	f, err := fh.root.Open(indexName)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	d, err := f.Stat()
+	if err != nil || d.IsDir() {
+		return false
+	}
+	// the index of spa must be revalidated, or the old assets may be loaded
+	w.Header().Set("Cache-Control", "no-cache")
+	etag, err := fh.strongETag(indexName, d, f)
+	if err != nil {
+		return false
+	}
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, d.Name(), d.ModTime(), f)
+	return true
+}
+
+func (fh *fileHandler) dirList(w http.ResponseWriter, r *http.Request, f http.File) {
+	dirs, err := f.Readdir(-1)
+	if err != nil {
+		http.Error(w, "Error reading directory", http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].Name() < dirs[j].Name() })
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<pre>\n")
+	for _, d := range dirs {
+		name := d.Name()
+		if d.IsDir() {
+			name += "/"
+		}
+		u := url.URL{Path: name}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", u.String(), html.EscapeString(name))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+}
@@ -0,0 +1,79 @@
+package netserve
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFileServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fileserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "assets"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte("<html>index</html>"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "assets", "app.js"), []byte("console.log(1)"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "assets", "app.js.gz"), []byte("gzipped"), 0644)
+
+	fs := NewFileServer(http.Dir(dir), FileServerConfig{
+		Precompressed: true,
+		CacheControls: []CacheControlRule{{Pattern: "/assets/*", Value: "public, max-age=31536000, immutable"}},
+		SPAFallback:   true,
+	})
+	get := func(path string, header map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		fs.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("/assets/app.js", map[string]string{"Accept-Encoding": "gzip, deflate"})
+	if w.Body.String() != "gzipped" || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("precompressed not served: %v %v", w.Header(), w.Body.String())
+	}
+	if w.Header().Get("Cache-Control") != "public, max-age=31536000, immutable" {
+		t.Fatalf("cache control %v", w.Header().Get("Cache-Control"))
+	}
+
+	w = get("/assets/app.js", nil)
+	etag := w.Header().Get("ETag")
+	if w.Body.String() != "console.log(1)" || etag == "" || etag[0] == 'W' {
+		t.Fatalf("plain file %v %v", w.Header(), w.Body.String())
+	}
+	if w = get("/assets/app.js", map[string]string{"If-None-Match": etag}); w.Code != http.StatusNotModified {
+		t.Fatalf("etag not matched %v", w.Code)
+	}
+
+	if w = get("/users/1", nil); w.Code != http.StatusOK || w.Body.String() != "<html>index</html>" {
+		t.Fatalf("spa fallback %v %v", w.Code, w.Body.String())
+	}
+	if w = get("/assets/none.js", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("missing asset %v", w.Code)
+	}
+}
+
+func TestFileServerZeroModTime(t *testing.T) {
+	// files of embed.FS have no ModTime, the content may change with the same
+	// size when the fs is swapped, so the etag must not be cached
+	mfs := fstest.MapFS{"app.js": {Data: []byte("console.log(1)")}}
+	fs := NewFileServer(http.FS(mfs), FileServerConfig{})
+	etagOf := func() string {
+		w := httptest.NewRecorder()
+		fs.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/app.js", nil))
+		return w.Header().Get("ETag")
+	}
+	etag := etagOf()
+	mfs["app.js"] = &fstest.MapFile{Data: []byte("console.log(2)")}
+	if newEtag := etagOf(); newEtag == "" || newEtag == etag {
+		t.Fatalf("etag %v should be changed from %v", newEtag, etag)
+	}
+}
@@ -0,0 +1,238 @@
+package netserve
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHealthTimeout  = 3 * time.Second
+	defaultHealthCacheTTL = 5 * time.Second
+)
+
+// health status
+const (
+	HealthOK   = "ok"
+	HealthFail = "fail"
+)
+
+// HealthCheckFunc return nil when the component is healthy
+type HealthCheckFunc func(ctx context.Context) error
+
+// HealthCheckOptions ...
+type HealthCheckOptions struct {
+	// Timeout of one check, default 3 seconds
+	Timeout time.Duration
+	// CacheTTL keep the result for a while, so the load balancers will not
+	// make the checks run too often, default 5 seconds
+	CacheTTL time.Duration
+	// Liveness checks are run by /healthz too, the others only by /readyz
+	Liveness bool
+}
+
+// HealthResult ...
+type HealthResult struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Duration  float64   `json:"duration_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// HealthReport ...
+type HealthReport struct {
+	Status string         `json:"status"`
+	Checks []HealthResult `json:"checks"`
+}
+
+type healthCheck struct {
+	name    string
+	check   HealthCheckFunc
+	options HealthCheckOptions
+
+	locker  sync.Mutex
+	result  HealthResult
+	running chan struct{}
+}
+
+// run return the cached result or wait the running check, the check has its
+// own timeout context, so a canceled ctx only stops the waiting of caller and
+// the result of check is still cached
+func (hc *healthCheck) run(ctx context.Context) HealthResult {
+	hc.locker.Lock()
+	if !hc.result.CheckedAt.IsZero() && time.Since(hc.result.CheckedAt) < hc.options.CacheTTL {
+		defer hc.locker.Unlock()
+		return hc.result
+	}
+	if hc.running == nil {
+		hc.running = make(chan struct{})
+		go hc.do()
+	}
+	running := hc.running
+	hc.locker.Unlock()
+
+	start := time.Now()
+	select {
+	case <-running:
+		hc.locker.Lock()
+		defer hc.locker.Unlock()
+		return hc.result
+	case <-ctx.Done():
+		return HealthResult{
+			Name:      hc.name,
+			Status:    HealthFail,
+			Error:     fmt.Sprintf("check canceled:%v", ctx.Err()),
+			Duration:  float64(time.Since(start)) / float64(time.Millisecond),
+			CheckedAt: start,
+		}
+	}
+}
+
+func (hc *healthCheck) do() {
+	ctx, cancel := context.WithTimeout(context.Background(), hc.options.Timeout)
+	defer cancel()
+	start := time.Now()
+	res := make(chan error, 1)
+	go func() {
+		defer func() {
+			if x := recover(); x != nil {
+				res <- fmt.Errorf("check panic:%v", x)
+			}
+		}()
+		res <- hc.check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-res:
+	case <-ctx.Done():
+		err = fmt.Errorf("check timeout after %v", hc.options.Timeout)
+	}
+
+	result := HealthResult{
+		Name:      hc.name,
+		Status:    HealthOK,
+		Duration:  float64(time.Since(start)) / float64(time.Millisecond),
+		CheckedAt: start,
+	}
+	if err != nil {
+		result.Status = HealthFail
+		result.Error = err.Error()
+	}
+	hc.locker.Lock()
+	defer hc.locker.Unlock()
+	hc.result = result
+	close(hc.running)
+	hc.running = nil
+}
+
+// HealthChecker run the registered checks for /healthz and /readyz
+type HealthChecker struct {
+	locker sync.RWMutex
+	checks []*healthCheck
+}
+
+// NewHealthChecker ...
+func NewHealthChecker() *HealthChecker {
+	return &HealthChecker{}
+}
+
+// Add register a check, a check with the same name is replaced
+func (h *HealthChecker) Add(name string, check HealthCheckFunc, options HealthCheckOptions) *HealthChecker {
+	if options.Timeout <= 0 {
+		options.Timeout = defaultHealthTimeout
+	}
+	if options.CacheTTL == 0 {
+		options.CacheTTL = defaultHealthCacheTTL
+	}
+	hc := &healthCheck{name: name, check: check, options: options}
+	h.locker.Lock()
+	defer h.locker.Unlock()
+	for i, c := range h.checks {
+		if c.name == name {
+			h.checks[i] = hc
+			return h
+		}
+	}
+	h.checks = append(h.checks, hc)
+	return h
+}
+
+// AddServeGroups check all listeners of groups are bound
+func (h *HealthChecker) AddServeGroups(groups []*ServeGroup, options HealthCheckOptions) *HealthChecker {
+	return h.Add("listeners", func(ctx context.Context) error {
+		var errs []string
+		for _, sg := range groups {
+			if err := sg.CheckListeners(ctx); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+		if len(errs) > 0 {
+			return fmt.Errorf("%s", strings.Join(errs, "; "))
+		}
+		return nil
+	}, options)
+}
+
+// Run run the checks in parallel, only the liveness checks are run if
+// liveness is true
+func (h *HealthChecker) Run(ctx context.Context, liveness bool) HealthReport {
+	h.locker.RLock()
+	var checks []*healthCheck
+	for _, c := range h.checks {
+		if !liveness || c.options.Liveness {
+			checks = append(checks, c)
+		}
+	}
+	h.locker.RUnlock()
+
+	report := HealthReport{Status: HealthOK, Checks: make([]HealthResult, len(checks))}
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *healthCheck) {
+			defer wg.Done()
+			report.Checks[i] = c.run(ctx)
+		}(i, c)
+	}
+	wg.Wait()
+	for _, res := range report.Checks {
+		if res.Status != HealthOK {
+			report.Status = HealthFail
+		}
+	}
+	return report
+}
+
+// Handler reply 200 or 503 with plain status for load balancers, the json
+// report is replied when the query has verbose or client accepts json
+func (h *HealthChecker) Handler(liveness bool) http.Handler {
+	return NoCache(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := h.Run(r.Context(), liveness)
+		code := http.StatusOK
+		if report.Status != HealthOK {
+			code = http.StatusServiceUnavailable
+		}
+		_, verbose := r.URL.Query()["verbose"]
+		if verbose || strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(code)
+			json.NewEncoder(w).Encode(report)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(code)
+		w.Write([]byte(report.Status + "\n"))
+	}))
+}
+
+// HandleHealth mount /healthz and /readyz, the results are not protected,
+// so the checks should not expose secrets in errors
+func (s *WebServe) HandleHealth(h *HealthChecker) {
+	s.Handle("/healthz", h.Handler(true))
+	s.Handle("/readyz", h.Handler(false))
+}
@@ -0,0 +1,80 @@
+package netserve
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthCheckCanceled(t *testing.T) {
+	var runs int32
+	release := make(chan struct{})
+	h := NewHealthChecker().Add("slow", func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}, HealthCheckOptions{Timeout: time.Second, CacheTTL: time.Minute})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if report := h.Run(ctx, false); report.Status != HealthFail {
+		t.Fatalf("canceled run got %+v", report)
+	}
+	// the canceled caller doesn't cancel the check and the failure is not cached
+	close(release)
+	if report := h.Run(context.Background(), false); report.Status != HealthOK {
+		t.Fatalf("got %+v", report)
+	}
+	if report := h.Run(context.Background(), false); report.Status != HealthOK || atomic.LoadInt32(&runs) != 1 {
+		t.Fatalf("result should be cached, got %+v runs %v", report, runs)
+	}
+}
+
+func TestHealthCheckTimeout(t *testing.T) {
+	var runs int32
+	h := NewHealthChecker().
+		Add("hang", func(ctx context.Context) error {
+			atomic.AddInt32(&runs, 1)
+			<-ctx.Done()
+			return ctx.Err()
+		}, HealthCheckOptions{Timeout: 20 * time.Millisecond, CacheTTL: time.Minute}).
+		Add("live", func(ctx context.Context) error {
+			return nil
+		}, HealthCheckOptions{Liveness: true}).
+		Add("panic", func(ctx context.Context) error {
+			panic(errors.New("boom"))
+		}, HealthCheckOptions{CacheTTL: -1})
+
+	report := h.Run(context.Background(), false)
+	if report.Status != HealthFail || len(report.Checks) != 3 {
+		t.Fatalf("got %+v", report)
+	}
+	for _, res := range report.Checks {
+		if (res.Name == "live") != (res.Status == HealthOK) {
+			t.Errorf("got %+v", res)
+		}
+	}
+	h.Run(context.Background(), false)
+	if atomic.LoadInt32(&runs) != 1 {
+		t.Errorf("timeout should be cached, runs %v", runs)
+	}
+
+	w := httptest.NewRecorder()
+	h.Handler(true).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "ok\n" {
+		t.Errorf("liveness got %v %v", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	h.Handler(false).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("readiness got %v", w.Code)
+	}
+}
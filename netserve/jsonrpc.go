@@ -0,0 +1,216 @@
+package netserve
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/asmexie/go-logger/logger"
+)
+
+const maxJSONRPCBodySize = 4 << 20
+
+// json-rpc 2.0 error codes
+const (
+	JSONRPCParseError     = -32700
+	JSONRPCInvalidRequest = -32600
+	JSONRPCMethodNotFound = -32601
+	JSONRPCInvalidParams  = -32602
+	JSONRPCInternalError  = -32603
+)
+
+// JSONRPCError is the error object of response, handlers can panic with it
+// to reply an error to client
+type JSONRPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *JSONRPCError) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+// NewJSONRPCError ...
+func NewJSONRPCError(code int, message string, data interface{}) *JSONRPCError {
+	return &JSONRPCError{Code: code, Message: message, Data: data}
+}
+
+// jsonrpcRequest keep ID as raw message, it's "null" for `"id": null` and
+// empty only if the member is absent, which means a notification
+type jsonrpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  json.RawMessage `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type jsonrpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *JSONRPCError   `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+var jsonNull = json.RawMessage("null")
+
+// rpcConn pass the params to handler and capture what it writes
+type rpcConn struct {
+	peer   string
+	params []byte
+	out    bytes.Buffer
+}
+
+func (c *rpcConn) Read() []byte {
+	return c.params
+}
+
+func (c *rpcConn) Write(p []byte) (int, error) {
+	return c.out.Write(p)
+}
+
+func (c *rpcConn) PeerAddr() string {
+	return c.peer
+}
+
+// JSONRPCHandler serve json-rpc 2.0 requests by APIHandler, the method is
+// converted by ConvertSApiToCode and a negative code means method not
+// found, the params are passed as the api data, and what the handler writes
+// is the result, it is sent as a json string if it's not valid json
+type JSONRPCHandler struct {
+	hd       APIHandler
+	ClientIP func(r *http.Request) string
+}
+
+// NewJSONRPCHandler ...
+func NewJSONRPCHandler(hd APIHandler) *JSONRPCHandler {
+	return &JSONRPCHandler{hd: hd, ClientIP: RemoteIP}
+}
+
+func rpcErrorResponse(id json.RawMessage, code int, message string) *jsonrpcResponse {
+	if id == nil {
+		id = jsonNull
+	}
+	return &jsonrpcResponse{JSONRPC: "2.0", Error: NewJSONRPCError(code, message, nil), ID: id}
+}
+
+func (h *JSONRPCHandler) call(peer string, api int, params []byte) (result json.RawMessage, rpcErr *JSONRPCError) {
+	defer func() {
+		if x := recover(); x != nil {
+			if e, ok := x.(*JSONRPCError); ok {
+				rpcErr = e
+				return
+			}
+			logger.Errorf("panic serving jsonrpc api %v, err:%v\n%s", api, x, debug.Stack())
+			rpcErr = NewJSONRPCError(JSONRPCInternalError, "Internal error", nil)
+		}
+	}()
+	conn := &rpcConn{peer: peer, params: params}
+	h.hd.HandleAPI(conn, api, params)
+	out := bytes.TrimSpace(conn.out.Bytes())
+	if len(out) == 0 {
+		return jsonNull, nil
+	}
+	if json.Valid(out) {
+		return json.RawMessage(out), nil
+	}
+	result, _ = json.Marshal(string(out))
+	return result, nil
+}
+
+// handle return nil for notifications
+func (h *JSONRPCHandler) handle(peer string, raw json.RawMessage) *jsonrpcResponse {
+	var req jsonrpcRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return rpcErrorResponse(nil, JSONRPCInvalidRequest, "Invalid Request")
+	}
+	id := req.ID
+	if len(id) > 0 && id[0] != '"' && id[0] != 'n' && id[0] != '-' && (id[0] < '0' || id[0] > '9') {
+		return rpcErrorResponse(nil, JSONRPCInvalidRequest, "Invalid Request")
+	}
+	var method string
+	if req.JSONRPC != "2.0" || json.Unmarshal(req.Method, &method) != nil || method == "" {
+		return rpcErrorResponse(id, JSONRPCInvalidRequest, "Invalid Request")
+	}
+	if len(req.Params) > 0 && req.Params[0] != '{' && req.Params[0] != '[' {
+		return rpcErrorResponse(id, JSONRPCInvalidParams, "Invalid params")
+	}
+
+	api := h.hd.ConvertSApiToCode(method)
+	var resp *jsonrpcResponse
+	if api < 0 {
+		resp = rpcErrorResponse(id, JSONRPCMethodNotFound, "Method not found")
+	} else {
+		result, rpcErr := h.call(peer, api, req.Params)
+		resp = &jsonrpcResponse{JSONRPC: "2.0", Result: result, Error: rpcErr, ID: id}
+		if rpcErr != nil {
+			resp.Result = nil
+		}
+	}
+	if len(req.ID) == 0 {
+		return nil
+	}
+	return resp
+}
+
+func (h *JSONRPCHandler) writeResponse(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error("write jsonrpc response failed:", err)
+	}
+}
+
+func (h *JSONRPCHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxJSONRPCBodySize))
+	if err != nil {
+		h.writeResponse(w, rpcErrorResponse(nil, JSONRPCParseError, "Parse error"))
+		return
+	}
+	body = bytes.TrimSpace(body)
+	if !json.Valid(body) {
+		h.writeResponse(w, rpcErrorResponse(nil, JSONRPCParseError, "Parse error"))
+		return
+	}
+	peer := h.ClientIP(r)
+
+	if len(body) > 0 && body[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(body, &batch); err != nil || len(batch) == 0 {
+			h.writeResponse(w, rpcErrorResponse(nil, JSONRPCInvalidRequest, "Invalid Request"))
+			return
+		}
+		var resps []*jsonrpcResponse
+		for _, raw := range batch {
+			if resp := h.handle(peer, raw); resp != nil {
+				resps = append(resps, resp)
+			}
+		}
+		if len(resps) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.writeResponse(w, resps)
+		return
+	}
+
+	if resp := h.handle(peer, body); resp != nil {
+		h.writeResponse(w, resp)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleJSONRPC serve json-rpc 2.0 of hd at path
+func (s *WebServe) HandleJSONRPC(path string, hd APIHandler) {
+	h := NewJSONRPCHandler(hd)
+	h.ClientIP = s.ClientIP
+	s.Handle(path, h)
+}
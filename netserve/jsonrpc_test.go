@@ -0,0 +1,95 @@
+package netserve
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestJSONRPC() *JSONRPCHandler {
+	return NewJSONRPCHandler(&testAPIHandler{
+		apis: map[string]int{"echo": 1, "fail": 2, "panic": 3, "text": 4, "panic value": 5},
+		handle: func(conn SimpleNetConn, api int, data []byte) {
+			switch api {
+			case 1:
+				conn.Write(data)
+			case 2:
+				panic(NewJSONRPCError(JSONRPCInvalidParams, "bad", nil))
+			case 3:
+				panic(errors.New("boom"))
+			case 4:
+				conn.Write([]byte("plain text"))
+			case 5:
+				panic("boom")
+			}
+		},
+	})
+}
+
+func postJSONRPC(t *testing.T, h http.Handler, body string) (int, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body)))
+	return w.Code, strings.TrimSpace(w.Body.String())
+}
+
+func TestJSONRPC(t *testing.T) {
+	h := newTestJSONRPC()
+	cases := []struct {
+		name string
+		body string
+		code int
+		resp string
+	}{
+		{"call", `{"jsonrpc":"2.0","method":"echo","params":[1,2],"id":1}`, 200,
+			`{"jsonrpc":"2.0","result":[1,2],"id":1}`},
+		{"string id", `{"jsonrpc":"2.0","method":"text","id":"a"}`, 200,
+			`{"jsonrpc":"2.0","result":"plain text","id":"a"}`},
+		{"null id", `{"jsonrpc":"2.0","method":"echo","params":{"a":1},"id":null}`, 200,
+			`{"jsonrpc":"2.0","result":{"a":1},"id":null}`},
+		{"notification", `{"jsonrpc":"2.0","method":"echo","params":[1]}`, 204, ``},
+		{"notification of unknown method", `{"jsonrpc":"2.0","method":"none"}`, 204, ``},
+		{"method not found", `{"jsonrpc":"2.0","method":"none","id":2}`, 200,
+			`{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":2}`},
+		{"handler error", `{"jsonrpc":"2.0","method":"fail","id":3}`, 200,
+			`{"jsonrpc":"2.0","error":{"code":-32602,"message":"bad"},"id":3}`},
+		{"handler panic", `{"jsonrpc":"2.0","method":"panic","id":4}`, 200,
+			`{"jsonrpc":"2.0","error":{"code":-32603,"message":"Internal error"},"id":4}`},
+		{"handler panic value", `{"jsonrpc":"2.0","method":"panic value","id":4}`, 200,
+			`{"jsonrpc":"2.0","error":{"code":-32603,"message":"Internal error"},"id":4}`},
+		{"invalid params", `{"jsonrpc":"2.0","method":"echo","params":1,"id":5}`, 200,
+			`{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params"},"id":5}`},
+		{"invalid version", `{"jsonrpc":"1.0","method":"echo","id":6}`, 200,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":6}`},
+		{"invalid id", `{"jsonrpc":"2.0","method":"echo","id":{}}`, 200,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}`},
+		{"parse error", `{"jsonrpc":"2.0",`, 200,
+			`{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error"},"id":null}`},
+		{"empty batch", `[]`, 200,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}`},
+		{"batch", `[{"jsonrpc":"2.0","method":"echo","params":[1],"id":1},{"jsonrpc":"2.0","method":"echo"},1,` +
+			`{"jsonrpc":"2.0","method":"none","id":null}]`, 200,
+			`[{"jsonrpc":"2.0","result":[1],"id":1},` +
+				`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null},` +
+				`{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":null}]`},
+		{"batch of notifications", `[{"jsonrpc":"2.0","method":"echo"},{"jsonrpc":"2.0","method":"text"}]`, 204, ``},
+	}
+	for _, c := range cases {
+		code, resp := postJSONRPC(t, h, c.body)
+		if code != c.code || resp != c.resp {
+			t.Errorf("%v got %v %v", c.name, code, resp)
+		}
+		if resp != "" && !json.Valid([]byte(resp)) {
+			t.Errorf("%v invalid response %v", c.name, resp)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/rpc", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("get got %v", w.Code)
+	}
+}
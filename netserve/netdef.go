@@ -12,11 +12,16 @@ type NetServeConfig struct {
 	WriteTimeOut int
 	Debug        int
 	HandlerName  string
+	RateLimits   []RateLimitConfig
+	AllowIPs     []string
+	DenyIPs      []string
 }
 
 // WebServeConfig ...
 type WebServeConfig struct {
-	Port         string
+	Port string
+	// Host are the addresses to listen, a host may carry its own port which
+	// is used instead of Port, e.g. 10.0.0.1:8443
 	Host         []string
 	PprofIps     []string
 	ReadTimeOut  int
@@ -24,6 +29,24 @@ type WebServeConfig struct {
 	WebPath      string
 	CertPath     string
 	KeyPath      string
+	// HTTPPort serve plain http beside https when CertPath is set
+	HTTPPort string
+	// RedirectHTTPS redirect the plain http requests on HTTPPort to https
+	RedirectHTTPS bool
+	// ShutdownTimeOut is the seconds waiting active requests when stopping
+	ShutdownTimeOut int
+	// AllowIPs and DenyIPs are ips or cidrs checked by IPAccess
+	AllowIPs []string
+	DenyIPs  []string
+	// TrustedProxies are the proxies whose X-Forwarded-For is trusted
+	TrustedProxies []string
+	// Certs are extra certificates selected by SNI beside CertPath
+	Certs []CertPair
+	// CertCheckInterval is the seconds polling certificate files for reloading
+	CertCheckInterval int
+	// ExposeErrorDetail reply the error messages and details of failed
+	// requests, it should be set only for debugging
+	ExposeErrorDetail bool
 }
 
 // APIHandler ...
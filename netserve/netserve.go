@@ -6,6 +6,7 @@ import (
 	"net"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/asmexie/gopub/common"
@@ -52,6 +53,7 @@ func (s *tcpserve) newTcpConn(rwc net.Conn) (c *conn) {
 	c.readTimeOut = rt
 	c.writeTimeOut = wt
 	c.context.logVerbose = s.nsc.LogVerbose
+	s.trackConn(c)
 	return c
 }
 
@@ -72,11 +74,16 @@ func (s *tcpserve) Serve(ctx context.Context) {
 			//fmt.Println("Error accepting: ", err.Error())
 			continue
 		}
+		if !s.access.Allowed(conn.RemoteAddr().String()) {
+			logger.Debugf("deny tcp conn from %v", conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
 
 		// Handle connections in a new goroutine.
 		c := s.newTcpConn(conn)
 		go c.HandleRequest()
-		if s.terminate {
+		if atomic.LoadInt32(&s.terminate) != 0 {
 			break
 		}
 	}
@@ -144,9 +151,13 @@ func (s *udpserve) Serve(ctx context.Context) {
 		} else if verbose {
 			logger.Debugf("readed udp data %d", n)
 		}
+		if !s.access.Allowed(addr.String()) {
+			logger.Debugf("deny udp packet from %v", addr)
+			continue
+		}
 		c := s.newUdpConn(buf[:n], addr)
 		go c.HandleRequest()
-		if s.terminate {
+		if atomic.LoadInt32(&s.terminate) != 0 {
 			break
 		}
 	}
@@ -4,14 +4,17 @@ import (
 	"bytes"
 	"crypto/md5"
 	"encoding/base64"
-	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
+	"reflect"
 	"strings"
 
 	"github.com/asmexie/gopub/common"
 	"github.com/asmexie/go-logger/logger"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protowire"
 )
 
 // PDecoder ...
@@ -52,6 +55,12 @@ func newDecoder(nsc NetServeConfig, hd APIHandler) PDecoder {
 		return &szpdecoder{BaseDecoder: BaseDecoder{nsc: nsc, hd: hd}}
 	case "mt":
 		return &mtpdecoder{BaseDecoder: BaseDecoder{nsc: nsc, hd: hd}}
+	case "web":
+		return &webdecoder{BaseDecoder: BaseDecoder{nsc: nsc, hd: hd}}
+	case "msgpack":
+		return &msgpdecoder{BaseDecoder: BaseDecoder{nsc: nsc, hd: hd}}
+	case "protobuf":
+		return &pbpdecoder{BaseDecoder: BaseDecoder{nsc: nsc, hd: hd}}
 	default:
 		panic(fmt.Errorf("not support trans cipher type %s", nsc.CodeType))
 	}
@@ -168,6 +177,12 @@ func (d *webdecoder) CheckSig(apidata WebApiData) {
 }
 
 func (d *webdecoder) Decode(buf []byte) (api int, data []byte, err error) {
+	_, api, data, err = d.DecodeApp(buf)
+	return
+}
+
+// DecodeApp ...
+func (d *webdecoder) DecodeApp(buf []byte) (app string, api int, data []byte, err error) {
 	s := string(bytes.Trim(buf, "\x00"))
 	logger.Debugf("recv web msg %s", s)
 	tmp, err := base64.StdEncoding.DecodeString(s)
@@ -177,6 +192,7 @@ func (d *webdecoder) Decode(buf []byte) (api int, data []byte, err error) {
 	err = json.Unmarshal(tmp, &apidata)
 	common.CheckError(err)
 	d.CheckSig(apidata)
+	app = apidata.App
 	api = d.ConvertSApiToCode(apidata.Api)
 	data = apidata.Data
 	return
@@ -186,10 +202,136 @@ type mtpdecoder struct {
 	BaseDecoder
 }
 
+// mtApiHdr is the api prefix of mt packets, the rest is decoded by handlers
+// with UnmarshalBinary
+type mtApiHdr struct {
+	Api  uint16
+	Data []byte `bin:"rest"`
+}
+
 func (d *mtpdecoder) Decode(buf []byte) (api int, data []byte, err error) {
 	//logger.Debugf("mt decoding data:% x", buf)
-	api = d.ConvertApiToCode(int(binary.LittleEndian.Uint16(buf)))
+	var hdr mtApiHdr
+	if err = UnmarshalBinary(buf, &hdr); err != nil {
+		logger.Debugf("mt decoding failed data % x", buf)
+		return
+	}
+	api = d.ConvertApiToCode(int(hdr.Api))
 	//logger.Debugf("mt got api:%d", api)
-	data = buf[2:]
+	data = hdr.Data
+	return
+}
+
+// ConvertAnyApiToCode convert a string api name or a numeric api code
+func (d BaseDecoder) ConvertAnyApiToCode(api interface{}) (int, error) {
+	v := reflect.ValueOf(api)
+	switch v.Kind() {
+	case reflect.String:
+		return d.ConvertSApiToCode(v.String()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return d.ConvertApiToCode(int(v.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return d.ConvertApiToCode(int(v.Uint())), nil
+	default:
+		return 0, fmt.Errorf("not support api type %T", api)
+	}
+}
+
+type msgpApiData struct {
+	Api  interface{}        `msgpack:"api"`
+	Data msgpack.RawMessage `msgpack:"data"`
+}
+
+// msgpdecoder decode a MessagePack map {api, data}, api is the api name or
+// api code, data is passed as raw bytes when it is bin/str, otherwise as the
+// MessagePack encoding of the value
+type msgpdecoder struct {
+	BaseDecoder
+}
+
+func (d *msgpdecoder) Decode(buf []byte) (api int, data []byte, err error) {
+	if len(buf) == 0 {
+		err = errors.New("decoding empty msgpack data")
+		return
+	}
+	var apiData msgpApiData
+	if err = msgpack.Unmarshal(buf, &apiData); err != nil {
+		logger.Debugf("decoding msgpack failed data % x", buf)
+		return
+	}
+	if api, err = d.ConvertAnyApiToCode(apiData.Api); err != nil {
+		return
+	}
+	data = apiData.Data
+	var raw []byte
+	if len(data) > 0 && msgpack.Unmarshal(data, &raw) == nil {
+		data = raw
+	}
+	if d.nsc.LogVerbose {
+		logger.Debugf("decoded msgpack api %v data % x", apiData.Api, data)
+	}
+	return
+}
+
+// protobuf envelope:
+//
+//	message ApiData {
+//	  string api      = 1;
+//	  bytes  data     = 2;
+//	  uint32 api_code = 3;
+//	}
+const (
+	pbFieldApi     = 1
+	pbFieldData    = 2
+	pbFieldApiCode = 3
+)
+
+type pbpdecoder struct {
+	BaseDecoder
+}
+
+func (d *pbpdecoder) Decode(buf []byte) (api int, data []byte, err error) {
+	if len(buf) == 0 {
+		err = errors.New("decoding empty protobuf data")
+		return
+	}
+	var apiName interface{}
+	for len(buf) > 0 {
+		num, typ, n := protowire.ConsumeTag(buf)
+		if n < 0 {
+			err = protowire.ParseError(n)
+			return
+		}
+		buf = buf[n:]
+		switch {
+		case num == pbFieldApi && typ == protowire.BytesType:
+			var v []byte
+			v, n = protowire.ConsumeBytes(buf)
+			apiName = string(v)
+		case num == pbFieldData && typ == protowire.BytesType:
+			data, n = protowire.ConsumeBytes(buf)
+		case num == pbFieldApiCode && typ == protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(buf)
+			if apiName == nil {
+				apiName = v
+			}
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, buf)
+		}
+		if n < 0 {
+			err = protowire.ParseError(n)
+			return
+		}
+		buf = buf[n:]
+	}
+	if apiName == nil {
+		err = errors.New("protobuf data missing api")
+		return
+	}
+	api, err = d.ConvertAnyApiToCode(apiName)
+	if d.nsc.LogVerbose {
+		logger.Debugf("decoded protobuf api %v data % x", apiName, data)
+	}
 	return
 }
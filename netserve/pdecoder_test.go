@@ -0,0 +1,109 @@
+package netserve
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// testAPIHandler map the api names by apis and the api codes to code+1000
+type testAPIHandler struct {
+	apis   map[string]int
+	handle func(conn SimpleNetConn, api int, data []byte)
+}
+
+func (h *testAPIHandler) HandleAPI(conn SimpleNetConn, api int, data []byte) {
+	if h.handle != nil {
+		h.handle(conn, api, data)
+	}
+}
+
+func (h *testAPIHandler) ConvertSApiToCode(apis string) int {
+	if code, ok := h.apis[apis]; ok {
+		return code
+	}
+	return -1
+}
+
+func (h *testAPIHandler) ConvertAPIToCode(api int) int {
+	return api + 1000
+}
+
+func (h *testAPIHandler) QueryAppSecretKey(app string) string {
+	return "key"
+}
+
+func msgpEnvelope(t *testing.T, api, data interface{}) []byte {
+	b, err := msgpack.Marshal(map[string]interface{}{"api": api, "data": data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func pbEnvelope(api string, apiCode uint64, data []byte) []byte {
+	var b []byte
+	if api != "" {
+		b = protowire.AppendTag(b, pbFieldApi, protowire.BytesType)
+		b = protowire.AppendString(b, api)
+	}
+	if apiCode != 0 {
+		b = protowire.AppendTag(b, pbFieldApiCode, protowire.VarintType)
+		b = protowire.AppendVarint(b, apiCode)
+	}
+	// unknown fields are skipped
+	b = protowire.AppendTag(b, 9, protowire.BytesType)
+	b = protowire.AppendBytes(b, []byte("skip"))
+	if data != nil {
+		b = protowire.AppendTag(b, pbFieldData, protowire.BytesType)
+		b = protowire.AppendBytes(b, data)
+	}
+	return b
+}
+
+func TestEnvelopeDecoders(t *testing.T) {
+	hd := &testAPIHandler{apis: map[string]int{"login": 1, "echo": 2}}
+	mapData, _ := msgpack.Marshal(map[string]int{"a": 1})
+	cases := []struct {
+		name     string
+		codeType string
+		buf      []byte
+		api      int
+		data     []byte
+		fail     bool
+	}{
+		{"msgpack name bin", "msgpack", msgpEnvelope(t, "login", []byte{1, 2, 3}), 1, []byte{1, 2, 3}, false},
+		{"msgpack name str", "msgpack", msgpEnvelope(t, "echo", "hello"), 2, []byte("hello"), false},
+		{"msgpack code", "msgpack", msgpEnvelope(t, 7, []byte("x")), 1007, []byte("x"), false},
+		{"msgpack uint code", "msgpack", msgpEnvelope(t, uint16(8), []byte("x")), 1008, []byte("x"), false},
+		{"msgpack map data", "msgpack", msgpEnvelope(t, "echo", map[string]int{"a": 1}), 2, mapData, false},
+		{"msgpack bad api", "msgpack", msgpEnvelope(t, 1.5, []byte("x")), 0, nil, true},
+		{"msgpack empty", "msgpack", nil, 0, nil, true},
+		{"msgpack broken", "msgpack", []byte{0x82, 0xa3}, 0, nil, true},
+		{"protobuf name", "protobuf", pbEnvelope("login", 0, []byte("pb")), 1, []byte("pb"), false},
+		{"protobuf code", "protobuf", pbEnvelope("", 5, []byte("pb")), 1005, []byte("pb"), false},
+		{"protobuf name first", "protobuf", pbEnvelope("echo", 5, []byte("pb")), 2, []byte("pb"), false},
+		{"protobuf no api", "protobuf", pbEnvelope("", 0, []byte("pb")), 0, nil, true},
+		{"protobuf truncated", "protobuf", pbEnvelope("login", 0, []byte("pb"))[:5], 0, nil, true},
+		{"protobuf empty", "protobuf", nil, 0, nil, true},
+	}
+	for _, c := range cases {
+		d := newDecoder(NetServeConfig{CodeType: c.codeType}, hd)
+		api, data, err := d.Decode(c.buf)
+		if c.fail {
+			if err == nil {
+				t.Errorf("%v expect error", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v failed:%v", c.name, err)
+			continue
+		}
+		if api != c.api || !bytes.Equal(data, c.data) {
+			t.Errorf("%v got api %v data % x", c.name, api, data)
+		}
+	}
+}
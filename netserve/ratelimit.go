@@ -0,0 +1,222 @@
+package netserve
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/asmexie/gopub/common"
+	gcc "github.com/patrickmn/go-cache"
+)
+
+// AnyApp matches every app in RateLimitConfig
+const AnyApp = "*"
+
+// RateLimitConfig limit requests of an app, the most special rule is used:
+// app and api > app > any app and api > any app. A rule with APIs has a
+// bucket for every api of the app, a rule without APIs has one bucket for
+// the app, rules of any app give every app its own bucket.
+//
+// The app is only known by the PDecoders implementing AppPDecoder (web), with
+// other decoders the app of all requests is empty, so App must be empty or
+// AnyApp and the rules limit all clients of the serve group together.
+type RateLimitConfig struct {
+	App         string
+	APIs        []int
+	Rate        float64
+	Burst       int
+	Quota       int64
+	QuotaPeriod int
+}
+
+func (rc RateLimitConfig) quotaPeriod() time.Duration {
+	if rc.QuotaPeriod <= 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(rc.QuotaPeriod) * time.Second
+}
+
+// RateLimitedHandler is implemented by APIHandler which wants to reply the
+// limited requests. If the APIHandler doesn't implement it, a limited request
+// is dropped silently: nothing is written back and the client only sees the
+// request time out, so handlers of request/reply protocols should implement it
+type RateLimitedHandler interface {
+	HandleRateLimited(conn SimpleNetConn, app string, api int)
+}
+
+// AppPDecoder is implemented by PDecoder which can identify the app
+type AppPDecoder interface {
+	DecodeApp(buf []byte) (app string, api int, data []byte, err error)
+}
+
+// AppUsage ...
+type AppUsage struct {
+	Allowed int64
+	Limited int64
+}
+
+type tokenBucket struct {
+	rc          *RateLimitConfig
+	tokens      float64
+	last        time.Time
+	quotaUsed   int64
+	quotaExpire time.Time
+}
+
+func (b *tokenBucket) allow(now time.Time) bool {
+	rc := b.rc
+	if rc.Quota > 0 {
+		if now.After(b.quotaExpire) {
+			b.quotaUsed = 0
+			b.quotaExpire = now.Add(rc.quotaPeriod())
+		}
+		if b.quotaUsed >= rc.Quota {
+			return false
+		}
+	}
+	if rc.Rate > 0 {
+		burst := float64(rc.Burst)
+		if burst < 1 {
+			burst = 1
+		}
+		b.tokens += now.Sub(b.last).Seconds() * rc.Rate
+		if b.tokens > burst {
+			b.tokens = burst
+		}
+		b.last = now
+		if b.tokens < 1 {
+			return false
+		}
+		b.tokens--
+	}
+	b.quotaUsed++
+	return true
+}
+
+// RateLimiter is a token bucket limiter keyed by app and api code
+type RateLimiter struct {
+	rules   map[string]*RateLimitConfig
+	buckets *gcc.Cache
+	usage   map[string]*AppUsage
+	locker  sync.Mutex
+}
+
+func rateRuleKey(app string, api int, anyAPI bool) string {
+	if anyAPI {
+		return app
+	}
+	return fmt.Sprintf("%s#%d", app, api)
+}
+
+// NewRateLimiter return nil when no rule configured
+func NewRateLimiter(configs []RateLimitConfig) *RateLimiter {
+	if len(configs) == 0 {
+		return nil
+	}
+	l := &RateLimiter{
+		rules:   map[string]*RateLimitConfig{},
+		buckets: gcc.New(time.Hour, 10*time.Minute),
+		usage:   map[string]*AppUsage{},
+	}
+	for i := range configs {
+		rc := &configs[i]
+		app := rc.App
+		if app == "" {
+			app = AnyApp
+		}
+		if len(rc.APIs) == 0 {
+			l.rules[rateRuleKey(app, 0, true)] = rc
+		}
+		for _, api := range rc.APIs {
+			l.rules[rateRuleKey(app, api, false)] = rc
+		}
+	}
+	return l
+}
+
+// newRateLimiter reject the rules of app if d can't identify the app
+func newRateLimiter(nsc NetServeConfig, d PDecoder) *RateLimiter {
+	if _, ok := d.(AppPDecoder); !ok {
+		for _, rc := range nsc.RateLimits {
+			if rc.App != "" && rc.App != AnyApp {
+				common.CheckError(fmt.Errorf("rate limit of app %v is not supported by code type %v",
+					rc.App, nsc.CodeType))
+			}
+		}
+	}
+	return NewRateLimiter(nsc.RateLimits)
+}
+
+// findRule return the rule of app and api, anyAPI is set if the rule covers
+// all apis of app
+func (l *RateLimiter) findRule(app string, api int) (rc *RateLimitConfig, anyAPI bool) {
+	for _, rule := range []struct {
+		app    string
+		anyAPI bool
+	}{{app, false}, {app, true}, {AnyApp, false}, {AnyApp, true}} {
+		if rc, ok := l.rules[rateRuleKey(rule.app, api, rule.anyAPI)]; ok {
+			return rc, rule.anyAPI
+		}
+	}
+	return nil, false
+}
+
+// Allow check and take a token for the request of app and api
+func (l *RateLimiter) Allow(app string, api int) bool {
+	if l == nil {
+		return true
+	}
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	usage, ok := l.usage[app]
+	if !ok {
+		usage = &AppUsage{}
+		l.usage[app] = usage
+	}
+
+	rc, anyAPI := l.findRule(app, api)
+	if rc == nil {
+		usage.Allowed++
+		return true
+	}
+	now := time.Now()
+	// the bucket is of the scope of rule, the app or the api of app
+	key := rateRuleKey(app, api, anyAPI)
+	var b *tokenBucket
+	if v, ok := l.buckets.Get(key); ok {
+		b = v.(*tokenBucket)
+	} else {
+		b = &tokenBucket{rc: rc, tokens: float64(rc.Burst), last: now}
+		if b.tokens < 1 {
+			b.tokens = 1
+		}
+	}
+	// refresh the expiration of bucket on every request, keep it during quota period
+	expire := time.Hour
+	if rc.Quota > 0 && rc.quotaPeriod() > expire {
+		expire = rc.quotaPeriod()
+	}
+	l.buckets.Set(key, b, expire)
+
+	if !b.allow(now) {
+		usage.Limited++
+		return false
+	}
+	usage.Allowed++
+	return true
+}
+
+// Usage return a copy of request counters of every app
+func (l *RateLimiter) Usage() map[string]AppUsage {
+	rs := map[string]AppUsage{}
+	if l == nil {
+		return rs
+	}
+	l.locker.Lock()
+	defer l.locker.Unlock()
+	for app, usage := range l.usage {
+		rs[app] = *usage
+	}
+	return rs
+}
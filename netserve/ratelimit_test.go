@@ -0,0 +1,48 @@
+package netserve
+
+import "testing"
+
+func TestRateLimiterScope(t *testing.T) {
+	l := NewRateLimiter([]RateLimitConfig{
+		{App: "a", Rate: 0.001, Burst: 2},
+		{App: "a", APIs: []int{9}, Rate: 0.001, Burst: 1},
+		{App: AnyApp, Rate: 0.001, Burst: 1},
+		{App: "q", Quota: 2},
+	})
+	allow := func(app string, api int, expect bool) {
+		t.Helper()
+		if l.Allow(app, api) != expect {
+			t.Errorf("allow %v %v expect %v", app, api, expect)
+		}
+	}
+	// the rule of app a has one bucket for all apis
+	allow("a", 1, true)
+	allow("a", 2, true)
+	allow("a", 3, false)
+	// the api rule has its own bucket
+	allow("a", 9, true)
+	allow("a", 9, false)
+	// the rule of any app gives every app a bucket
+	allow("b", 1, true)
+	allow("b", 2, false)
+	allow("c", 1, true)
+	// the quota is of the app
+	allow("q", 1, true)
+	allow("q", 2, true)
+	allow("q", 3, false)
+}
+
+func TestRateLimiterRejectApp(t *testing.T) {
+	hd := &testAPIHandler{}
+	nsc := NetServeConfig{CodeType: "msgpack", RateLimits: []RateLimitConfig{{App: AnyApp, Rate: 1}}}
+	if newRateLimiter(nsc, newDecoder(nsc, hd)) == nil {
+		t.Fatal("rule of any app should be accepted")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("rule of app should be rejected by msgpack decoder")
+		}
+	}()
+	nsc.RateLimits = []RateLimitConfig{{App: "a", Rate: 1}}
+	newRateLimiter(nsc, newDecoder(nsc, hd))
+}
@@ -0,0 +1,29 @@
+package netserve
+
+import (
+	"net/http"
+
+	"github.com/asmexie/gopub/common"
+	"github.com/asmexie/gopub/netutils"
+)
+
+// RequestID read or create the request id and trace of request, they are
+// stored in the request context and echoed in the response headers, use
+// common.RequestIDFrom(r.Context()) to get the id in handlers
+func RequestID(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tc := common.TraceFrom(r.Context())
+		if tc == nil {
+			tc = netutils.TraceFromRequest(r)
+			r = r.WithContext(common.WithTrace(r.Context(), tc))
+		}
+		w.Header().Set(netutils.HeaderRequestID, tc.RequestID)
+		w.Header().Set(netutils.HeaderTraceParent, tc.TraceParent())
+		h.ServeHTTP(w, r)
+	})
+}
+
+// RequestID ...
+func (s *WebServe) RequestID(f http.Handler) http.Handler {
+	return RequestID(f)
+}
@@ -0,0 +1,45 @@
+package netserve
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/asmexie/gopub/common"
+	"github.com/asmexie/gopub/netutils"
+)
+
+func TestRequestIDTrace(t *testing.T) {
+	const traceID, spanID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	var got *common.TraceContext
+	h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = common.TraceFrom(r.Context())
+	}))
+	serve := func(traceParent string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set(netutils.HeaderTraceParent, traceParent)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve("00-" + traceID + "-" + spanID + "-01")
+	parts := strings.Split(w.Header().Get(netutils.HeaderTraceParent), "-")
+	if len(parts) != 4 || parts[1] != traceID || parts[3] != "01" {
+		t.Fatalf("got traceparent %v", w.Header().Get(netutils.HeaderTraceParent))
+	}
+	if parts[2] == spanID || got.SpanID != parts[2] {
+		t.Errorf("server span %v should be new, caller span %v", parts[2], spanID)
+	}
+
+	for _, flags := range []string{"zz", "0G", "1"} {
+		w = serve("00-" + traceID + "-" + spanID + "-" + flags)
+		if strings.Contains(w.Header().Get(netutils.HeaderTraceParent), traceID) {
+			t.Errorf("traceparent with flags %v should be rejected", flags)
+		}
+	}
+	if _, err := common.ParseTraceParent("00-" + traceID + "-" + spanID + "-00"); err != nil {
+		t.Error(err)
+	}
+}
@@ -3,10 +3,13 @@ package netserve
 import (
 	"bufio"
 	"context"
+	"fmt"
 	"io"
 	"sync"
+	"sync/atomic"
 
 	"github.com/asmexie/gopub/common"
+	"github.com/asmexie/gopub/netutils"
 )
 
 var (
@@ -47,25 +50,78 @@ func putBufioWriter(bw *bufio.Writer) {
 
 // ServeGroup ...
 type ServeGroup struct {
-	terminate bool
+	terminate int32
 	nsc       NetServeConfig
 	cipher    TransCipher
 	d         PDecoder
 	hd        APIHandler
+	limiter   *RateLimiter
+	access    *netutils.IPAccess
+
+	connsLocker sync.Mutex
+	conns       map[*conn]struct{}
+
+	listenExpected int32
+	listenBound    int32
 }
 
 // ListenAndServeServeGroups ...
-func ListenAndServeServeGroups(ctx context.Context, netconfigs []NetServeConfig, f NameToAPIHandler) {
+func ListenAndServeServeGroups(ctx context.Context, netconfigs []NetServeConfig, f NameToAPIHandler) (groups []*ServeGroup) {
 	for _, nsc := range netconfigs {
 		hd := f(nsc.HandlerName)
+		d := newDecoder(nsc, hd)
 		tcp := &ServeGroup{
-			nsc:    nsc,
-			cipher: NewTransCipher(nsc.Cipher),
-			d:      newDecoder(nsc, hd),
-			hd:     hd,
+			nsc:     nsc,
+			cipher:  NewTransCipher(nsc.Cipher),
+			d:       d,
+			hd:      hd,
+			limiter: newRateLimiter(nsc, d),
+			access:  newNetAccess(nsc),
 		}
 		go tcp.Serve(ctx)
+		groups = append(groups, tcp)
+	}
+	return
+}
+
+func (sg *ServeGroup) trackConn(c *conn) {
+	sg.connsLocker.Lock()
+	defer sg.connsLocker.Unlock()
+	if sg.conns == nil {
+		sg.conns = map[*conn]struct{}{}
+	}
+	sg.conns[c] = struct{}{}
+}
+
+func (sg *ServeGroup) untrackConn(c *conn) {
+	sg.connsLocker.Lock()
+	defer sg.connsLocker.Unlock()
+	delete(sg.conns, c)
+}
+
+func newNetAccess(nsc NetServeConfig) *netutils.IPAccess {
+	if len(nsc.AllowIPs) == 0 && len(nsc.DenyIPs) == 0 {
+		return nil
 	}
+	access, err := netutils.NewIPAccess(netutils.IPAccessConfig{
+		Allow: nsc.AllowIPs,
+		Deny:  nsc.DenyIPs,
+	})
+	common.CheckError(err)
+	return access
+}
+
+// AppUsage return request counters of every app
+func (sg *ServeGroup) AppUsage() map[string]AppUsage {
+	return sg.limiter.Usage()
+}
+
+func (sg *ServeGroup) decode(buf []byte) (app string, api int, data []byte, err error) {
+	if d, ok := sg.d.(AppPDecoder); ok {
+		return d.DecodeApp(buf)
+	}
+	api, data, err = sg.d.Decode(buf)
+	return
 }
 
 // Serve ...
@@ -75,13 +131,16 @@ func (sg *ServeGroup) Serve(ctx context.Context) {
 			common.LogError(x)
 		}
 	}()
-	sg.terminate = false
+	atomic.StoreInt32(&sg.terminate, 0)
 	tp := sg.nsc
+	atomic.StoreInt32(&sg.listenBound, 0)
+	atomic.StoreInt32(&sg.listenExpected, int32(len(tp.NetType)*len(tp.ListenIP)*len(tp.Port)))
 	var serves []NetServe
 	for _, nettype := range tp.NetType {
 		for _, ip := range tp.ListenIP {
 			for _, port := range tp.Port {
 				serves = append(serves, newNetServe(sg, nettype, ip, port))
+				atomic.AddInt32(&sg.listenBound, 1)
 			}
 		}
 	}
@@ -91,7 +150,20 @@ func (sg *ServeGroup) Serve(ctx context.Context) {
 	}
 }
 
+// CheckListeners return error if not all listeners are bound, it is used as
+// health check
+func (sg *ServeGroup) CheckListeners(ctx context.Context) error {
+	expected, bound := atomic.LoadInt32(&sg.listenExpected), atomic.LoadInt32(&sg.listenBound)
+	if atomic.LoadInt32(&sg.terminate) != 0 {
+		return fmt.Errorf("serve %v stopped", sg.nsc.HandlerName)
+	}
+	if expected == 0 || bound < expected {
+		return fmt.Errorf("serve %v bound %d of %d listeners", sg.nsc.HandlerName, bound, expected)
+	}
+	return nil
+}
+
 // Stop ...
 func (sg *ServeGroup) Stop() {
-	sg.terminate = true
+	atomic.StoreInt32(&sg.terminate, 1)
 }
@@ -28,6 +28,16 @@ type TransCipher interface {
 	DecodeRead(context *NetContext, buf *bufio.Reader) []byte
 }
 
+// PacketCipher is implemented by the ciphers whose EncodeWrite depends on the
+// stream state of context, EncodePacket always encode data as a whole packet
+// and is used by the message based transports, e.g. websocket
+type PacketCipher interface {
+	EncodePacket(context *NetContext, buf *bufio.Writer, data []byte) error
+}
+
+// ErrNoPacketKey is returned by EncodePacket before any packet is received
+var ErrNoPacketKey = errors.New("no packet key received")
+
 func checkArgsMinSize(args []string, size int) {
 	if len(args) < size {
 		panic(fmt.Errorf("arg  <<%s>> size less than %d", strings.Join(args, " "), size))
@@ -44,7 +54,12 @@ func NewTransCipher(cipherCfg []string) TransCipher {
 		checkArgsMinSize(cipherCfg, 2)
 		key, err := base64.StdEncoding.DecodeString(cipherCfg[1])
 		common.CheckError(err)
-		return newszcipher(key)
+		c := newszcipher(key)
+		if len(cipherCfg) > 2 {
+			// optional compress algorithms in preference order, e.g. "snappy,gzip"
+			c.compress = parseCompressAlgs(cipherCfg[2])
+		}
+		return c
 	case "cccfg":
 		checkArgsMinSize(cipherCfg, 2)
 		return newCccfgCipher(cipherCfg[1])
@@ -120,9 +135,10 @@ func (c *eleCipher) DecodeRead(context *NetContext, buf *bufio.Reader) []byte {
 }
 
 type szcipher struct {
-	rsakeyb []byte
-	rsaKey  *rsa.PrivateKey
-	Seq     uint32
+	rsakeyb  []byte
+	rsaKey   *rsa.PrivateKey
+	Seq      uint32
+	compress []byte
 }
 
 func newszcipher(rsakey []byte) *szcipher {
@@ -312,11 +328,45 @@ func (c *szcipher) EncryptAckData(context *NetContext, data []byte) (rs []byte)
 	return
 }
 
+func (c *szcipher) acceptCompress() (algs byte) {
+	for _, alg := range c.compress {
+		algs |= alg
+	}
+	return
+}
+
+func (c *szcipher) compressAckData(context *NetContext, hdr *TransPacketHdr, data []byte) []byte {
+	// only answer with compress flags to peers which sent them
+	if context.acceptCompress == 0 || len(c.compress) == 0 {
+		return data
+	}
+	hdr.SetAcceptCompress(c.acceptCompress())
+	if context.stream || len(data) < minCompressSize {
+		return data
+	}
+	alg := selectCompress(c.compress, context.acceptCompress)
+	if alg == CompressNone {
+		return data
+	}
+	tmp, err := CompressData(alg, data)
+	if err != nil {
+		common.LogError(err)
+		return data
+	}
+	if len(tmp) >= len(data) {
+		return data
+	}
+	context.Verbosef("compress ack data type %d size %d to %d", alg, len(data), len(tmp))
+	hdr.SetCompress(alg)
+	return tmp
+}
+
 func (c *szcipher) WriteAckData(context *NetContext, buf *bufio.Writer, data []byte) {
 	var hdr TransPacketHdr
 	context.seq = atomic.AddUint32(&c.Seq, 1)
 
 	context.BuildAckHdr(&hdr)
+	data = c.compressAckData(context, &hdr, data)
 
 	encodedData := c.EncryptAckData(context, data)
 
@@ -362,6 +412,8 @@ func (c *szcipher) WriteAckData(context *NetContext, buf *bufio.Writer, data []b
 }
 
 func (c *szcipher) EncodeWrite(context *NetContext, buf *bufio.Writer, data []byte) {
+	context.locker.Lock()
+	defer context.locker.Unlock()
 	//context.Verbosef("EncodeWrite:% x", data)
 	if context.state == 2 || context.state == 10 {
 		c.WriteAckData(context, buf, data)
@@ -372,6 +424,23 @@ func (c *szcipher) EncodeWrite(context *NetContext, buf *bufio.Writer, data []by
 	}
 }
 
+// EncodePacket write data as an ack packet, the ack is of the last received
+// packet, the first ack after a receiving derive a new send iv and the later
+// ones reuse it, so the peer can push only after it has sent a packet
+func (c *szcipher) EncodePacket(context *NetContext, buf *bufio.Writer, data []byte) error {
+	context.locker.Lock()
+	defer context.locker.Unlock()
+	if len(context.aeskey) == 0 {
+		return ErrNoPacketKey
+	}
+	if context.state != 2 {
+		context.state = 10
+	}
+	context.stream = false
+	c.WriteAckData(context, buf, data)
+	return nil
+}
+
 func (c *szcipher) CalcCheckSum(data []byte) uint64 {
 	var checkSum uint64
 	binary.LittleEndian.PutUint64(data, checkSum)
@@ -382,6 +451,8 @@ func (c *szcipher) CalcCheckSum(data []byte) uint64 {
 }
 
 func (c *szcipher) DecodeData(context *NetContext, data []byte) (rs []byte) {
+	context.locker.Lock()
+	defer context.locker.Unlock()
 	var hdr TransPacketHdr
 	size := packhdrsize
 
@@ -403,10 +474,15 @@ func (c *szcipher) DecodeData(context *NetContext, data []byte) (rs []byte) {
 
 	var aeskeyb []byte
 	rs, aeskeyb, context.recviv = c.DecryptSyncData(context, hdr, data[size:])
+	if alg := hdr.Compress(); alg != CompressNone {
+		rs, err = DecompressData(alg, rs)
+		common.CheckError(err)
+	}
+	context.acceptCompress = hdr.AcceptCompress()
 
 	context.aeskey = append([]byte{}, aeskeyb...)
 	context.updateiv = true
-	if hdr.Msgtype == 1 {
+	if hdr.MsgType() == 1 {
 		context.state = 2
 	} else {
 		context.state = 10
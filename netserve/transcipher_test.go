@@ -1,8 +1,11 @@
 package netserve
 
 import (
+	"bufio"
+	"bytes"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/binary"
 	"testing"
 
 	"github.com/asmexie/gopub/common"
@@ -20,3 +23,99 @@ func TestRSAKey(t *testing.T) {
 	common.CheckError(err)
 	logger.Debugf("got public key:% x", data)
 }
+
+func TestCompressData(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"api":"query","data":{"status":0}}`), 64)
+	for _, alg := range parseCompressAlgs("gzip,snappy") {
+		tmp, err := CompressData(alg, data)
+		common.CheckError(err)
+		rs, err := DecompressData(alg, tmp)
+		common.CheckError(err)
+		if !bytes.Equal(rs, data) {
+			t.Fatalf("compress type %d round trip failed", alg)
+		}
+		logger.Debugf("compress type %d size %d to %d", alg, len(data), len(tmp))
+	}
+
+	var hdr TransPacketHdr
+	hdr.Msgtype = 3
+	hdr.SetAcceptCompress(CompressGzip | CompressSnappy)
+	hdr.SetCompress(CompressSnappy)
+	if hdr.MsgType() != 3 || hdr.Compress() != CompressSnappy ||
+		selectCompress([]byte{CompressGzip}, hdr.AcceptCompress()) != CompressGzip {
+		t.Fatalf("packet hdr compress flags error %x", hdr.Msgtype)
+	}
+}
+
+// CompressedPacket return the packet of msgtype 2 carrying data compressed by
+// alg in the aes part, accept is the algorithms the client accepts
+func (c *szTestClient) CompressedPacket(t *testing.T, alg, accept byte, data []byte) []byte {
+	hdr := TransPacketHdr{Msgtype: 2}
+	hdr.SetCompress(alg)
+	hdr.SetAcceptCompress(accept)
+	return c.packet(t, hdr, nil, data)
+}
+
+func TestCompressPacket(t *testing.T) {
+	client, cfg := newSzTestClient(t)
+	c := NewTransCipher(append(cfg, "snappy,gzip"))
+	context := NewNetContext("127.0.0.1:9")
+	large := bytes.Repeat([]byte(`{"api":"query","data":{"status":0}}`), 64)
+	small := []byte(`{"status":0}`)
+
+	decode := func(pkt []byte) (data []byte, err error) {
+		defer func() {
+			if x := recover(); x != nil {
+				err = x.(error)
+			}
+		}()
+		return c.DecodeRead(context, bufio.NewReader(bytes.NewReader(pkt))), nil
+	}
+	reply := func(data []byte) ([]byte, byte) {
+		var out bytes.Buffer
+		bw := bufio.NewWriter(&out)
+		c.EncodeWrite(context, bw, data)
+		bw.Flush()
+		rs, err := client.ReadAck(out.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rs, client.compress
+	}
+
+	cases := []struct {
+		name   string
+		alg    byte
+		accept byte
+		reply  []byte
+		expect byte
+	}{
+		{"gzip request snappy reply", CompressGzip, CompressGzip | CompressSnappy, large, CompressSnappy},
+		{"snappy request gzip reply", CompressSnappy, CompressGzip, large, CompressGzip},
+		{"reply under threshold", CompressGzip, CompressGzip, small, CompressNone},
+		{"client accept nothing", CompressNone, CompressNone, large, CompressNone},
+	}
+	for _, cs := range cases {
+		body, err := CompressData(cs.alg, large)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := decode(client.CompressedPacket(t, cs.alg, cs.accept, body))
+		if err != nil || !bytes.Equal(data, large) {
+			t.Fatalf("%v decode got %v", cs.name, err)
+		}
+		rs, alg := reply(cs.reply)
+		if !bytes.Equal(rs, cs.reply) || alg != cs.expect {
+			t.Errorf("%v reply compress %v expect %v", cs.name, alg, cs.expect)
+		}
+	}
+
+	// the decompressed size is limited
+	huge, _ := CompressData(CompressGzip, make([]byte, maxDecompressedSize+1))
+	fake := binary.AppendUvarint(nil, maxDecompressedSize+1)
+	for alg, body := range map[byte][]byte{CompressGzip: huge, CompressSnappy: append(fake, 0)} {
+		if _, err := decode(client.CompressedPacket(t, alg, 0, body)); err == nil {
+			t.Errorf("compress type %d oversized data should be rejected", alg)
+		}
+	}
+}
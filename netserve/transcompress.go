@@ -0,0 +1,142 @@
+package netserve
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/golang/snappy"
+)
+
+// sz12 packets carry compression negotiation in TransPacketHdr.Msgtype:
+//
+//	bits 0-7   message type
+//	bits 8-15  compress algorithms the sender accepts
+//	bits 16-23 compress algorithm applied to this packet payload
+//
+// old clients leave the high bits zero, so they never get compressed replies.
+const (
+	msgTypeMask         uint32 = 0xff
+	msgAcceptShift             = 8
+	msgCompressShift           = 16
+	minCompressSize            = 256
+	maxDecompressedSize        = 16 << 20
+	compressFlagMask    uint32 = 0xff
+)
+
+// compress algorithm flags
+const (
+	CompressNone   byte = 0
+	CompressGzip   byte = 1
+	CompressSnappy byte = 2
+)
+
+// MsgType ...
+func (hdr TransPacketHdr) MsgType() uint32 {
+	return hdr.Msgtype & msgTypeMask
+}
+
+// AcceptCompress ...
+func (hdr TransPacketHdr) AcceptCompress() byte {
+	return byte((hdr.Msgtype >> msgAcceptShift) & compressFlagMask)
+}
+
+// Compress ...
+func (hdr TransPacketHdr) Compress() byte {
+	return byte((hdr.Msgtype >> msgCompressShift) & compressFlagMask)
+}
+
+// SetCompress ...
+func (hdr *TransPacketHdr) SetCompress(alg byte) {
+	hdr.Msgtype &^= compressFlagMask << msgCompressShift
+	hdr.Msgtype |= uint32(alg) << msgCompressShift
+}
+
+// SetAcceptCompress ...
+func (hdr *TransPacketHdr) SetAcceptCompress(algs byte) {
+	hdr.Msgtype &^= compressFlagMask << msgAcceptShift
+	hdr.Msgtype |= uint32(algs) << msgAcceptShift
+}
+
+func parseCompressAlgs(s string) (algs []byte) {
+	for _, name := range strings.Split(s, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "gzip":
+			algs = append(algs, CompressGzip)
+		case "snappy":
+			algs = append(algs, CompressSnappy)
+		case "", "none":
+		default:
+			panic(fmt.Errorf("not support compress type %s", name))
+		}
+	}
+	return
+}
+
+// selectCompress return the first of our algorithms the peer accepts
+func selectCompress(algs []byte, accept byte) byte {
+	for _, alg := range algs {
+		if accept&alg != 0 {
+			return alg
+		}
+	}
+	return CompressNone
+}
+
+// CompressData ...
+func CompressData(alg byte, data []byte) ([]byte, error) {
+	switch alg {
+	case CompressNone:
+		return data, nil
+	case CompressGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressSnappy:
+		return snappy.Encode(nil, data), nil
+	default:
+		return nil, fmt.Errorf("not support compress type %d", alg)
+	}
+}
+
+// DecompressData ...
+func DecompressData(alg byte, data []byte) ([]byte, error) {
+	switch alg {
+	case CompressNone:
+		return data, nil
+	case CompressGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		rs, err := ioutil.ReadAll(io.LimitReader(r, maxDecompressedSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(rs) > maxDecompressedSize {
+			return nil, fmt.Errorf("decompressed size exceed %d", maxDecompressedSize)
+		}
+		return rs, nil
+	case CompressSnappy:
+		n, err := snappy.DecodedLen(data)
+		if err != nil {
+			return nil, err
+		}
+		if n > maxDecompressedSize {
+			return nil, fmt.Errorf("decompressed size %d too large", n)
+		}
+		return snappy.Decode(nil, data)
+	default:
+		return nil, fmt.Errorf("not support compress type %d", alg)
+	}
+}
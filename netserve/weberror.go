@@ -0,0 +1,186 @@
+package netserve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime/debug"
+
+	"github.com/asmexie/gopub/netutils"
+	"github.com/asmexie/go-logger/logger"
+)
+
+// HTTPError is an error with http status, Code is the status of reply json
+// and it's the http status if it's 0, Detail of 5xx errors is only replied
+// when ExposeErrorDetail of config is set
+type HTTPError struct {
+	Status  int
+	Code    int
+	Message string
+	Detail  interface{}
+	Err     error
+}
+
+// NewHTTPError ...
+func NewHTTPError(status int, message string) *HTTPError {
+	return &HTTPError{Status: status, Message: message}
+}
+
+// WrapHTTPError ...
+func WrapHTTPError(status int, err error) *HTTPError {
+	return &HTTPError{Status: status, Err: err}
+}
+
+func (e *HTTPError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.Status)
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("%d %s: %v", e.Status, msg, e.Err)
+	}
+	return fmt.Sprintf("%d %s", e.Status, msg)
+}
+
+// Unwrap ...
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// WithCode set the status of reply json
+func (e *HTTPError) WithCode(code int) *HTTPError {
+	e.Code = code
+	return e
+}
+
+// WithDetail ...
+func (e *HTTPError) WithDetail(detail interface{}) *HTTPError {
+	e.Detail = detail
+	return e
+}
+
+// ErrorMapper convert err to HTTPError, it returns nil if it doesn't know err
+type ErrorMapper func(err error) *HTTPError
+
+// ErrorHandlerFunc is a handler returning error, the error is replied by
+// WriteError
+type ErrorHandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+func defaultErrorMapper(err error) *HTTPError {
+	var he *HTTPError
+	var bindErrs BindErrors
+	switch {
+	case errors.As(err, &he):
+		return he
+	case errors.As(err, &bindErrs):
+		return bindErrs.HTTPError()
+	case errors.Is(err, os.ErrNotExist):
+		return WrapHTTPError(http.StatusNotFound, err)
+	case errors.Is(err, os.ErrPermission):
+		return WrapHTTPError(http.StatusForbidden, err)
+	case errors.Is(err, context.DeadlineExceeded):
+		return WrapHTTPError(http.StatusGatewayTimeout, err)
+	case errors.Is(err, context.Canceled):
+		return WrapHTTPError(499, err)
+	}
+	return WrapHTTPError(http.StatusInternalServerError, err)
+}
+
+// MapError map the errors matched target by errors.Is to status
+func (s *WebServe) MapError(target error, status int) {
+	s.MapErrorFunc(func(err error) *HTTPError {
+		if errors.Is(err, target) {
+			return WrapHTTPError(status, err)
+		}
+		return nil
+	})
+}
+
+// MapErrorFunc add an error mapper, the mappers are checked in order before
+// the default one
+func (s *WebServe) MapErrorFunc(f ErrorMapper) {
+	s.errorMappers = append(s.errorMappers, f)
+}
+
+func (s *WebServe) toHTTPError(err error) *HTTPError {
+	for _, f := range s.errorMappers {
+		if he := f(err); he != nil {
+			return he
+		}
+	}
+	return defaultErrorMapper(err)
+}
+
+func (s *WebServe) exposeErrorDetail() bool {
+	return s.config != nil && s.config.ExposeErrorDetail
+}
+
+// WriteError reply err as json by netutils.HTTPReplyJSON, the message and
+// detail of 5xx errors are hidden unless ExposeErrorDetail is set
+func (s *WebServe) WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	s.writeError(w, r, err, true)
+}
+
+func (s *WebServe) writeError(w http.ResponseWriter, r *http.Request, err error, logErr bool) {
+	he := s.toHTTPError(err)
+	status := he.Status
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	code := he.Code
+	if code == 0 {
+		code = status
+	}
+	requestID := requestIDOf(r, w)
+	if logErr && status >= http.StatusInternalServerError {
+		logger.Errorf("serve %v %v failed, request_id:%v, err:%v", r.Method, r.URL, requestID, err)
+	}
+
+	msg := he.Message
+	if msg == "" || (status >= http.StatusInternalServerError && !s.exposeErrorDetail()) {
+		msg = http.StatusText(status)
+	}
+	reply := netutils.NewHTTPReplyJSON(map[int]string{}, code)
+	reply.SetStatusAndMsg(code, msg)
+	if requestID != "" {
+		reply.Set("request_id", requestID)
+	}
+	if he.Detail != nil && (status < http.StatusInternalServerError || s.exposeErrorDetail()) {
+		reply.Set("data", he.Detail)
+	}
+	if s.exposeErrorDetail() {
+		reply.Set("error", err.Error())
+	}
+	reply.WriteReplyStatus(w, status)
+}
+
+// ErrorFunc convert f to handler, the returned error is replied by WriteError
+func (s *WebServe) ErrorFunc(f ErrorHandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := f(w, r); err != nil {
+			s.WriteError(w, r, err)
+		}
+	})
+}
+
+// recoverPanic log the panic of handler with stack and request id, the
+// panic is replied as error if nothing is written
+func (s *WebServe) recoverPanic(w *statusWriter, r *http.Request, x interface{}) {
+	if x == http.ErrAbortHandler {
+		panic(x)
+	}
+	err, ok := x.(error)
+	if !ok {
+		err = fmt.Errorf("%v", x)
+	}
+	// the stack is logged for HTTPError too to find where it's panicked
+	logger.Errorf("panic serving %v %v, request_id:%v, err:%v\n%s",
+		r.Method, r.URL, requestIDOf(r, w), x, debug.Stack())
+	if w.status != 0 {
+		// the response is written partly, nothing can be done
+		return
+	}
+	s.writeError(w, r, err, false)
+}
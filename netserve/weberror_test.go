@@ -0,0 +1,88 @@
+package netserve
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var errTestQuota = errors.New("quota exceeded")
+
+func newTestErrorServe(expose bool) WebServe {
+	s := NewWebServe(&WebServeConfig{ExposeErrorDetail: expose})
+	s.MapError(errTestQuota, http.StatusTooManyRequests)
+	s.Router.Handle("/bad", s.ErrorFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return NewHTTPError(http.StatusBadRequest, "bad input").WithCode(1001).WithDetail("name")
+	}))
+	s.Router.Handle("/quota", s.ErrorFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return fmt.Errorf("call api: %w", errTestQuota)
+	}))
+	s.Router.Handle("/internal", s.ErrorFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return WrapHTTPError(http.StatusServiceUnavailable, errors.New("db down")).WithDetail("dsn")
+	}))
+	s.Router.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	s.Router.HandleFunc("/panic-http", func(w http.ResponseWriter, r *http.Request) {
+		panic(NewHTTPError(http.StatusForbidden, "denied"))
+	})
+	s.Router.HandleFunc("/written", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("partial"))
+		panic(errors.New("boom"))
+	})
+	s.Router.HandleFunc("/abort", func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+	return s
+}
+
+func TestWriteError(t *testing.T) {
+	cases := []struct {
+		path   string
+		expose bool
+		status int
+		reply  string
+	}{
+		{"/bad", false, 400, `{"data":"name","msg":"bad input","request_id":"r1","status":1001}`},
+		{"/quota", false, 429, `{"msg":"Too Many Requests","request_id":"r1","status":429}`},
+		{"/internal", false, 503, `{"msg":"Service Unavailable","request_id":"r1","status":503}`},
+		{"/internal", true, 503, `{"data":"dsn","error":"503 Service Unavailable: db down","msg":"Service Unavailable",` +
+			`"request_id":"r1","status":503}`},
+		{"/panic", false, 500, `{"msg":"Internal Server Error","request_id":"r1","status":500}`},
+		{"/panic", true, 500, `{"error":"boom","msg":"Internal Server Error","request_id":"r1","status":500}`},
+		{"/panic-http", false, 403, `{"msg":"denied","request_id":"r1","status":403}`},
+	}
+	for _, c := range cases {
+		s := newTestErrorServe(c.expose)
+		r := httptest.NewRequest(http.MethodGet, c.path, nil)
+		r.Header.Set(HeaderRequestID, "r1")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		var reply interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &reply); err != nil {
+			t.Fatalf("%v reply %v", c.path, w.Body.String())
+		}
+		data, _ := json.Marshal(reply)
+		if w.Code != c.status || string(data) != c.reply {
+			t.Errorf("%v expose %v got %v %s", c.path, c.expose, w.Code, data)
+		}
+	}
+
+	s := newTestErrorServe(true)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/written", nil))
+	if w.Code != http.StatusAccepted || w.Body.String() != "partial" {
+		t.Errorf("written response got %v %v", w.Code, w.Body.String())
+	}
+
+	defer func() {
+		if x := recover(); x != http.ErrAbortHandler {
+			t.Errorf("abort got %v", x)
+		}
+	}()
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/abort", nil))
+}
@@ -1,6 +1,7 @@
 package netserve
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
@@ -36,6 +37,9 @@ var etagHeaders = []string{
 type WebServe struct {
 	*mux.Router
 	config *WebServeConfig
+	access *netutils.IPAccess
+
+	errorMappers []ErrorMapper
 }
 
 // GetQueryStrVar ...
@@ -68,22 +72,12 @@ func GetQueryIntVar(r *http.Request, key string) int {
 	return v
 }
 
-// OnlyLocal ...
+var localAccess = netutils.NewIPAccessWithNets(netutils.PrivateNets, nil, nil)
+
+// OnlyLocal allow only the clients from loopback and private networks, the
+// peer address is checked and forwarded headers are ignored
 func OnlyLocal(h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Delete any ETag headers that may have been set
-		ips := strings.Split(r.Host, ":")
-		if nil == net.ParseIP(ips[0]) {
-			http.Error(w, "internal error", 500)
-			return
-		}
-		if strings.HasPrefix(r.Host, "172.16.") ||
-			strings.HasPrefix(r.Host, "192.168.") {
-			h.ServeHTTP(w, r)
-			return
-		}
-		http.Error(w, "internal error", 500)
-	})
+	return localAccess.Handler(h)
 }
 
 // NoCache ...
@@ -109,22 +103,29 @@ func NoCache(h http.Handler) http.Handler {
 
 // ServeHTTP ...
 func (s *WebServe) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sw := &statusWriter{ResponseWriter: w}
 	defer func() {
 		if x := recover(); x != nil {
-			logger.Error(r.URL.String(), x)
-			if r.Host[:9] == "localhost" {
-				http.Error(w, x.(error).Error(), http.StatusInternalServerError)
-			} else {
-				http.Error(w, "internal error", 500)
-			}
+			s.recoverPanic(sw, r, x)
 		}
 	}()
-	s.Router.ServeHTTP(w, r)
+	s.Router.ServeHTTP(sw, r)
 }
 
-// OnlyLocal ...
+// OnlyLocal allow only the clients from loopback and private networks, the
+// TrustedProxies of config are used to find the client ip
 func (s *WebServe) OnlyLocal(f http.Handler) http.Handler {
-	return OnlyLocal(f)
+	return netutils.NewIPAccessWithNets(netutils.PrivateNets, nil, s.access.Trusted()).Handler(f)
+}
+
+// IPAccess check the client ip by AllowIPs and DenyIPs of config
+func (s *WebServe) IPAccess(f http.Handler) http.Handler {
+	return s.access.Handler(f)
+}
+
+// ClientIP return the client ip resolved with TrustedProxies of config
+func (s *WebServe) ClientIP(r *http.Request) string {
+	return s.access.ClientIP(r)
 }
 
 // NoCache ...
@@ -157,22 +158,201 @@ func (s *WebServe) GetQueryStrVar(r *http.Request, key string) string {
 	return GetQueryStrVar(r, key)
 }
 
-// Run ...
-func (s *WebServe) Run(handler http.Handler) {
-	logger.Info("new webserver on " + s.config.Port)
-	server := &http.Server{
-		Addr:           ":" + s.config.Port,
+func (s *WebServe) newServer(handler http.Handler) *http.Server {
+	return &http.Server{
 		Handler:        handler,
 		ReadTimeout:    time.Duration(s.config.ReadTimeOut) * time.Second,
 		WriteTimeout:   time.Duration(s.config.WriteTimeOut) * time.Second,
 		MaxHeaderBytes: 1 << 20,
 	}
+}
+
+// webHost is a configured host, port is empty if the host has no own port
+type webHost struct {
+	host string
+	port string
+}
+
+// webHosts return the configured hosts, all interfaces if no host configured
+func (s *WebServe) webHosts() []webHost {
+	if len(s.config.Host) == 0 {
+		return []webHost{{}}
+	}
+	hosts := []webHost{}
+	for _, host := range s.config.Host {
+		if h, port, err := net.SplitHostPort(host); err == nil {
+			hosts = append(hosts, webHost{host: h, port: port})
+		} else {
+			hosts = append(hosts, webHost{host: strings.Trim(host, "[]")})
+		}
+	}
+	return hosts
+}
+
+// listenAddrs return the addresses of the main listeners, a host may carry
+// its own port instead of Port
+func (s *WebServe) listenAddrs() []string {
+	addrs := []string{}
+	seen := map[string]bool{}
+	for _, h := range s.webHosts() {
+		port := h.port
+		if port == "" {
+			port = s.config.Port
+		}
+		addr := net.JoinHostPort(h.host, port)
+		if !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// httpListenAddrs return the addresses of the plain http listeners beside
+// https, all hosts listen on HTTPPort, tlsPorts are the https ports of the
+// same hosts to redirect to
+func (s *WebServe) httpListenAddrs() (addrs, tlsPorts []string) {
+	seen := map[string]bool{}
+	for _, h := range s.webHosts() {
+		addr := net.JoinHostPort(h.host, s.config.HTTPPort)
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		tlsPort := h.port
+		if tlsPort == "" {
+			tlsPort = s.config.Port
+		}
+		addrs = append(addrs, addr)
+		tlsPorts = append(tlsPorts, tlsPort)
+	}
+	return
+}
+
+func (s *WebServe) certPairs() (pairs []CertPair) {
+	if s.config.CertPath != "" {
+		pairs = append(pairs, CertPair{CertPath: s.config.CertPath, KeyPath: s.config.KeyPath})
+	}
+	return append(pairs, s.config.Certs...)
+}
+
+func (s *WebServe) shutdownTimeout() time.Duration {
+	if s.config.ShutdownTimeOut <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(s.config.ShutdownTimeOut) * time.Second
+}
+
+// RedirectHTTPS redirect request to the https url on port, keep the host if
+// port is empty
+func RedirectHTTPS(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		u := *r.URL
+		u.Scheme = "https"
+		u.Host = host
+		http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+	})
+}
+
+// Run serve handler on all configured addresses until ctx is done, then
+// shutdown gracefully, handler is the WebServe itself if nil
+func (s *WebServe) Run(ctx context.Context, handler http.Handler) error {
+	if handler == nil {
+		handler = s
+	}
+	type serveFunc func(l net.Listener) error
+	var servers []*http.Server
+	var listeners []net.Listener
+	var serves []serveFunc
+
+	listen := func(addrs []string, server *http.Server, serve serveFunc) error {
+		for _, addr := range addrs {
+			l, err := net.Listen("tcp", addr)
+			if err != nil {
+				return err
+			}
+			logger.Info("new webserver on " + l.Addr().String())
+			listeners = append(listeners, l)
+			serves = append(serves, serve)
+		}
+		servers = append(servers, server)
+		return nil
+	}
+	closeListeners := func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}
 
-	if s.config.CertPath == "" {
-		logger.Fatal(server.ListenAndServe())
+	var err error
+	server := s.newServer(handler)
+	certPairs := s.certPairs()
+	if len(certPairs) == 0 {
+		err = listen(s.listenAddrs(), server, server.Serve)
 	} else {
-		logger.Fatal(server.ListenAndServeTLS(s.config.CertPath, s.config.KeyPath))
+		var certMgr *CertManager
+		if certMgr, err = NewCertManager(certPairs); err != nil {
+			return err
+		}
+		watchCtx, cancelWatch := context.WithCancel(ctx)
+		defer cancelWatch()
+		go certMgr.Watch(watchCtx, time.Duration(s.config.CertCheckInterval)*time.Second)
+		server.TLSConfig = certMgr.TLSConfig()
+		err = listen(s.listenAddrs(), server, func(l net.Listener) error {
+			return server.ServeTLS(l, "", "")
+		})
+		if err == nil && s.config.HTTPPort != "" {
+			addrs, tlsPorts := s.httpListenAddrs()
+			for i := 0; i < len(addrs) && err == nil; i++ {
+				httpHandler := handler
+				if s.config.RedirectHTTPS {
+					// redirect to the https port of the same host
+					httpHandler = RedirectHTTPS(tlsPorts[i])
+				}
+				httpServer := s.newServer(httpHandler)
+				err = listen(addrs[i:i+1], httpServer, httpServer.Serve)
+			}
+		}
+	}
+	if err != nil {
+		closeListeners()
+		return err
+	}
+
+	errc := make(chan error, len(listeners))
+	for i, l := range listeners {
+		go func(l net.Listener, serve serveFunc) {
+			errc <- serve(l)
+		}(l, serves[i])
 	}
+
+	select {
+	case err = <-errc:
+		logger.Error("webserver stopped:", err)
+	case <-ctx.Done():
+		logger.Info("shutting down webserver")
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout())
+	defer cancel()
+	for _, server := range servers {
+		if e := server.Shutdown(shutdownCtx); e != nil {
+			common.LogError(e)
+			server.Close()
+		}
+	}
+	closeListeners()
+	if err == http.ErrServerClosed {
+		err = nil
+	}
+	return err
 }
 
 // NewWebServe ...
@@ -181,5 +361,12 @@ func NewWebServe(config *WebServeConfig) WebServe {
 		Router: mux.NewRouter(),
 	}
 	s.config = config
+	access, err := netutils.NewIPAccess(netutils.IPAccessConfig{
+		Allow:          config.AllowIPs,
+		Deny:           config.DenyIPs,
+		TrustedProxies: config.TrustedProxies,
+	})
+	common.CheckError(err)
+	s.access = access
 	return s
 }
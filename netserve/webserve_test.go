@@ -0,0 +1,122 @@
+package netserve
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert write a self signed certificate of 127.0.0.1 and 127.0.0.2
+func writeTestCert(t *testing.T, dir string) (certPath, keyPath string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("127.0.0.2")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath, keyPath = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return
+}
+
+func freePort(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	return port
+}
+
+func TestRunHostPorts(t *testing.T) {
+	certPath, keyPath := writeTestCert(t, t.TempDir())
+	ownPort, port, httpPort := freePort(t), freePort(t), freePort(t)
+	s := NewWebServe(&WebServeConfig{
+		Port:          port,
+		Host:          []string{"127.0.0.1:" + ownPort, "127.0.0.2"},
+		CertPath:      certPath,
+		KeyPath:       keyPath,
+		HTTPPort:      httpPort,
+		RedirectHTTPS: true,
+	})
+	s.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("pong"))
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.Run(ctx, nil)
+	}()
+	defer func() {
+		cancel()
+		if err := <-errc; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	get := func(url string) *http.Response {
+		for i := 0; ; i++ {
+			resp, err := client.Get(url)
+			if err == nil {
+				resp.Body.Close()
+				return resp
+			}
+			select {
+			case err := <-errc:
+				t.Fatalf("run failed:%v", err)
+			case <-time.After(20 * time.Millisecond):
+			}
+			if i > 100 {
+				t.Fatalf("get %v failed:%v", url, err)
+			}
+		}
+	}
+
+	for _, addr := range []string{"127.0.0.1:" + ownPort, "127.0.0.2:" + port} {
+		if resp := get("https://" + addr + "/ping"); resp.StatusCode != http.StatusOK {
+			t.Errorf("https %v got status %v", addr, resp.StatusCode)
+		}
+	}
+	for host, tlsAddr := range map[string]string{
+		"127.0.0.1": "127.0.0.1:" + ownPort,
+		"127.0.0.2": "127.0.0.2:" + port,
+	} {
+		resp := get("http://" + net.JoinHostPort(host, httpPort) + "/ping")
+		if loc := resp.Header.Get("Location"); loc != "https://"+tlsAddr+"/ping" {
+			t.Errorf("http %v redirect to %v", host, loc)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package netserve
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/asmexie/gopub/common"
+	"github.com/asmexie/go-logger/logger"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultWSReadTimeOut = 60 * time.Second
+	defaultWSReadLimit   = 1 << 20
+)
+
+// ErrWSClosed is returned when writing to a closed websocket
+var ErrWSClosed = errors.New("websocket closed")
+
+// WSEventHandler is implemented by the APIHandler which wants to know when
+// the websocket is opened or closed, e.g. to keep the conn for pushing
+type WSEventHandler interface {
+	HandleWSOpen(c *WSConn)
+	HandleWSClose(c *WSConn)
+}
+
+// WSConn is a websocket of WSServe, every message is a packet of the trans
+// cipher, handlers can keep it to push messages to client.
+// With the sz12 cipher every message sent is a whole ack packet of msgtype 3
+// (2 for the first ack of a sync packet), the replies and pushes share the
+// sequence and the ack of last received packet, so a push fails with
+// ErrNoPacketKey until the client has sent a packet
+type WSConn struct {
+	id      uint64
+	ws      *websocket.Conn
+	s       *WSServe
+	peer    string
+	context *NetContext
+
+	writeLocker sync.Mutex
+	closed      int32
+}
+
+// ID ...
+func (c *WSConn) ID() uint64 {
+	return c.id
+}
+
+// PeerAddr ...
+func (c *WSConn) PeerAddr() string {
+	return c.peer
+}
+
+// Context ...
+func (c *WSConn) Context() *NetContext {
+	return c.context
+}
+
+// decode is serialized with the encoding of Write by the lock of context
+// held by the cipher
+func (c *WSConn) decode(msg []byte) []byte {
+	c.context.recvBytes.Add(int64(len(msg)))
+	return c.s.sg.cipher.DecodeRead(c.context, bufio.NewReader(bytes.NewReader(msg)))
+}
+
+// Read read and decode the next message, it must be called only by the
+// handler which is handling a message of the conn
+func (c *WSConn) Read() []byte {
+	_, msg, err := c.ws.ReadMessage()
+	common.CheckError(err)
+	return c.decode(msg)
+}
+
+// Write encode data and send it as a binary message, it's safe to call it
+// from any goroutine
+func (c *WSConn) Write(data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	if atomic.LoadInt32(&c.closed) != 0 {
+		return 0, ErrWSClosed
+	}
+	var out bytes.Buffer
+	bw := bufio.NewWriter(&out)
+
+	c.writeLocker.Lock()
+	defer c.writeLocker.Unlock()
+	// encode in lock so the messages are sent in the order of the send state
+	if pc, ok := c.s.sg.cipher.(PacketCipher); ok {
+		if err := pc.EncodePacket(c.context, bw, data); err != nil {
+			return 0, err
+		}
+	} else {
+		c.s.sg.cipher.EncodeWrite(c.context, bw, data)
+	}
+	bw.Flush()
+	if t := c.s.writeTimeOut(); t > 0 {
+		c.ws.SetWriteDeadline(time.Now().Add(t))
+	}
+	if err := c.ws.WriteMessage(websocket.BinaryMessage, out.Bytes()); err != nil {
+		return 0, err
+	}
+	c.context.sendBytes.Add(int64(out.Len()))
+	return len(data), nil
+}
+
+// Push is Write for the unsolicited messages
+func (c *WSConn) Push(data []byte) error {
+	_, err := c.Write(data)
+	return err
+}
+
+// Close ...
+func (c *WSConn) Close() error {
+	if !atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		return nil
+	}
+	c.ws.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	return c.ws.Close()
+}
+
+func (c *WSConn) handleMessage(msg []byte) {
+	defer func() {
+		if x := recover(); x != nil {
+			common.LogError(x)
+		}
+	}()
+	rawData := c.decode(msg)
+	if len(rawData) == 0 {
+		c.context.Verbosef("receive ws data is empty")
+		return
+	}
+	app, api, data, err := c.s.sg.decode(rawData)
+	if err != nil {
+		common.LogError(err)
+		return
+	}
+	c.context.Verbosef("recv ws ip %v app %v api %v data:% x\n", c.peer, app, api, data)
+	if !c.s.sg.limiter.Allow(app, api) {
+		c.context.Verbosef("app %v api %v is rate limited", app, api)
+		if h, ok := c.s.sg.hd.(RateLimitedHandler); ok {
+			h.HandleRateLimited(c, app, api)
+		}
+		return
+	}
+	c.s.sg.hd.HandleAPI(c, api, data)
+}
+
+func (c *WSConn) keepAlive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if atomic.LoadInt32(&c.closed) != 0 {
+			return
+		}
+		if err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(interval)); err != nil {
+			return
+		}
+	}
+}
+
+func (c *WSConn) serve() {
+	readTimeOut := c.s.readTimeOut()
+	c.ws.SetReadLimit(defaultWSReadLimit)
+	c.ws.SetReadDeadline(time.Now().Add(readTimeOut))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(readTimeOut))
+	})
+	go c.keepAlive(readTimeOut / 2)
+
+	for {
+		mt, msg, err := c.ws.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				c.context.Verbosef("read ws %v failed:%v", c.peer, err)
+			}
+			return
+		}
+		if mt != websocket.BinaryMessage && mt != websocket.TextMessage {
+			continue
+		}
+		c.ws.SetReadDeadline(time.Now().Add(readTimeOut))
+		c.handleMessage(msg)
+	}
+}
+
+// WSServe serve the apis of a handler on websocket, the Cipher, CodeType,
+// LogVerbose, ReadTimeOut, WriteTimeOut, RateLimits, AllowIPs and DenyIPs
+// of NetServeConfig are used, the messages are not ciphered if Cipher is empty
+type WSServe struct {
+	sg       *ServeGroup
+	upgrader websocket.Upgrader
+	ClientIP func(r *http.Request) string
+
+	locker sync.Mutex
+	conns  map[uint64]*WSConn
+	lastID atomic.Uint64
+}
+
+// NewWSServe ...
+func NewWSServe(nsc NetServeConfig, hd APIHandler) *WSServe {
+	d := newDecoder(nsc, hd)
+	sg := &ServeGroup{
+		nsc:     nsc,
+		d:       d,
+		hd:      hd,
+		limiter: newRateLimiter(nsc, d),
+		access:  newNetAccess(nsc),
+	}
+	if len(nsc.Cipher) == 0 {
+		sg.cipher = &emptycipher{}
+	} else {
+		sg.cipher = NewTransCipher(nsc.Cipher)
+	}
+	return &WSServe{
+		sg:       sg,
+		ClientIP: RemoteIP,
+		conns:    map[uint64]*WSConn{},
+	}
+}
+
+// SetCheckOrigin set the origin checker of upgrade, by default only the
+// requests from the same host are accepted
+func (s *WSServe) SetCheckOrigin(f func(r *http.Request) bool) {
+	s.upgrader.CheckOrigin = f
+}
+
+func (s *WSServe) readTimeOut() time.Duration {
+	if s.sg.nsc.ReadTimeOut > 0 {
+		return time.Duration(s.sg.nsc.ReadTimeOut) * time.Second
+	}
+	return defaultWSReadTimeOut
+}
+
+func (s *WSServe) writeTimeOut() time.Duration {
+	return time.Duration(s.sg.nsc.WriteTimeOut) * time.Second
+}
+
+func (s *WSServe) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	peer := s.ClientIP(r)
+	if !s.sg.access.Allowed(peer) {
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+		return
+	}
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has replied the error
+		logger.Debugf("upgrade websocket from %v failed:%v", peer, err)
+		return
+	}
+	c := &WSConn{
+		id:      s.lastID.Add(1),
+		ws:      ws,
+		s:       s,
+		peer:    peer,
+		context: NewNetContext(peer),
+	}
+	c.context.logVerbose = s.sg.nsc.LogVerbose
+
+	s.locker.Lock()
+	s.conns[c.id] = c
+	s.locker.Unlock()
+	h, _ := s.sg.hd.(WSEventHandler)
+	if h != nil {
+		h.HandleWSOpen(c)
+	}
+	defer func() {
+		c.Close()
+		s.locker.Lock()
+		delete(s.conns, c.id)
+		s.locker.Unlock()
+		if h != nil {
+			h.HandleWSClose(c)
+		}
+	}()
+	c.serve()
+}
+
+// Conn return the opened conn by id, nil if it's closed
+func (s *WSServe) Conn(id uint64) *WSConn {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	return s.conns[id]
+}
+
+// Conns ...
+func (s *WSServe) Conns() []*WSConn {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	conns := make([]*WSConn, 0, len(s.conns))
+	for _, c := range s.conns {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+// Broadcast push data to all opened conns
+func (s *WSServe) Broadcast(data []byte) {
+	for _, c := range s.Conns() {
+		if err := c.Push(data); err != nil {
+			c.context.Verbosef("push to %v failed:%v", c.peer, err)
+		}
+	}
+}
+
+// HandleWebSocket serve the apis of hd on websocket at path
+func (s *WebServe) HandleWebSocket(path string, nsc NetServeConfig, hd APIHandler) *WSServe {
+	ws := NewWSServe(nsc, hd)
+	ws.ClientIP = s.ClientIP
+	s.Handle(path, ws)
+	return ws
+}
@@ -0,0 +1,81 @@
+package netserve
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWSPushAndReceive(t *testing.T) {
+	client, cfg := newSzTestClient(t)
+	hd := &testAPIHandler{
+		apis: map[string]int{"ping": 1},
+		handle: func(conn SimpleNetConn, api int, data []byte) {
+			conn.Write([]byte("pong"))
+		},
+	}
+	s := NewWSServe(NetServeConfig{Cipher: cfg, CodeType: "msgpack"}, hd)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	var conns []*WSConn
+	for i := 0; len(conns) == 0; i++ {
+		if i > 100 {
+			t.Fatal("conn is not opened")
+		}
+		time.Sleep(10 * time.Millisecond)
+		conns = s.Conns()
+	}
+	if err := conns[0].Push([]byte("early")); err != ErrNoPacketKey {
+		t.Fatalf("push before receiving got %v", err)
+	}
+
+	packets := make([][]byte, 20)
+	for i := range packets {
+		packets[i] = client.Packet(t, msgpEnvelope(t, "ping", []byte("x")))
+	}
+	ws.SetReadDeadline(time.Now().Add(10 * time.Second))
+	read := func() string {
+		_, msg, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		plain, err := client.ReadAck(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(plain)
+	}
+	ws.WriteMessage(websocket.BinaryMessage, packets[0])
+	if msg := read(); msg != "pong" {
+		t.Fatalf("got %v", msg)
+	}
+
+	const pushes = 50
+	go func() {
+		for i := 0; i < pushes; i++ {
+			s.Broadcast([]byte("push"))
+		}
+	}()
+	go func() {
+		for _, pkt := range packets[1:] {
+			ws.WriteMessage(websocket.BinaryMessage, pkt)
+		}
+	}()
+	counts := map[string]int{}
+	for counts["pong"] < len(packets)-1 || counts["push"] < pushes {
+		msg := read()
+		if msg != "pong" && msg != "push" {
+			t.Fatalf("got %v", msg)
+		}
+		counts[msg]++
+	}
+}
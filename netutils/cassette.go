@@ -0,0 +1,400 @@
+package netutils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// CassetteMode ...
+type CassetteMode int
+
+const (
+	// CassetteReplay only replay the recorded interactions, the unmatched
+	// requests fail with ErrCassetteMiss
+	CassetteReplay CassetteMode = iota
+	// CassetteRecord send all requests and record them, the cassette is
+	// overwritten
+	CassetteRecord
+	// CassetteReplayOrRecord replay the matched requests and record others
+	CassetteReplayOrRecord
+)
+
+const redactedValue = "[REDACTED]"
+
+// ErrCassetteMiss is returned in replay mode if no interaction matches
+var ErrCassetteMiss = errors.New("no recorded interaction matches request")
+
+var (
+	defaultRedactFields  = []string{KNameSign, KNameNonceStr}
+	defaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+)
+
+// CassetteRequest ...
+type CassetteRequest struct {
+	Method       string      `json:"method"`
+	URL          string      `json:"url"`
+	Header       http.Header `json:"header,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"body_encoding,omitempty"`
+}
+
+// CassetteResponse ...
+type CassetteResponse struct {
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"body_encoding,omitempty"`
+}
+
+// Interaction is a recorded request and its response
+type Interaction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+
+	key  string
+	used bool
+}
+
+// RecorderConfig ...
+type RecorderConfig struct {
+	// Path is the cassette file, it's json
+	Path string
+	Mode CassetteMode
+	// RedactFields are the query, form and json fields which are replaced in
+	// cassette and ignored by matching, default sign and nonce_str
+	RedactFields []string
+	// RedactHeaders are the request and response headers replaced in
+	// cassette, default Authorization, Proxy-Authorization, Cookie and
+	// Set-Cookie
+	RedactHeaders []string
+	// Transport sends the requests to record, it's the transport of client
+	// if it's plugged by WithRecorder
+	Transport http.RoundTripper
+}
+
+// Recorder is a RoundTripper recording the interactions to cassette and
+// replaying them, requests are matched by method, url, normalized query and
+// body, the same requests are replayed in the order they were recorded
+type Recorder struct {
+	config RecorderConfig
+	redact map[string]bool
+
+	locker       sync.Mutex
+	interactions []*Interaction
+}
+
+// NewRecorder load the cassette of config if it exists
+func NewRecorder(config RecorderConfig) (*Recorder, error) {
+	if config.RedactFields == nil {
+		config.RedactFields = defaultRedactFields
+	}
+	if config.RedactHeaders == nil {
+		config.RedactHeaders = defaultRedactHeaders
+	}
+	rec := &Recorder{config: config, redact: map[string]bool{}}
+	for _, f := range config.RedactFields {
+		rec.redact[f] = true
+	}
+	if config.Mode == CassetteRecord {
+		return rec, nil
+	}
+
+	data, err := ioutil.ReadFile(config.Path)
+	if os.IsNotExist(err) && config.Mode == CassetteReplayOrRecord {
+		return rec, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &rec.interactions); err != nil {
+		return nil, fmt.Errorf("load cassette %v failed: %v", config.Path, err)
+	}
+	for _, it := range rec.interactions {
+		body, err := decodeCassetteBody(it.Request.Body, it.Request.BodyEncoding)
+		if err != nil {
+			return nil, err
+		}
+		it.key = rec.matchKey(it.Request.Method, it.Request.URL, it.Request.Header.Get("Content-Type"), body)
+	}
+	return rec, nil
+}
+
+// WithRecorder plug rec into client under the retry and circuit breaker, the
+// transport of client is used to record if rec has no Transport. A recorder
+// can be shared by clients, it's not changed by them
+func WithRecorder(rec *Recorder) HTTPClientOption {
+	return func(client *HTTPClient) {
+		client.recorder = rec
+	}
+}
+
+// recordingTransport is the recorder plugged into a client, next is the
+// transport of the client
+type recordingTransport struct {
+	rec  *Recorder
+	next http.RoundTripper
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.rec.roundTrip(req, t.next)
+}
+
+func encodeCassetteBody(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+func decodeCassetteBody(body, encoding string) ([]byte, error) {
+	if encoding == "base64" {
+		return base64.StdEncoding.DecodeString(body)
+	}
+	return []byte(body), nil
+}
+
+// redactHeader return a copy of header with the values of RedactHeaders
+// replaced
+func (rec *Recorder) redactHeader(header http.Header) http.Header {
+	header = header.Clone()
+	for _, h := range rec.config.RedactHeaders {
+		if len(header.Values(h)) > 0 {
+			header.Set(h, redactedValue)
+		}
+	}
+	return header
+}
+
+func (rec *Recorder) redactValues(values url.Values, remove bool) {
+	for k := range values {
+		if !rec.redact[k] {
+			continue
+		}
+		if remove {
+			delete(values, k)
+		} else {
+			values[k] = []string{redactedValue}
+		}
+	}
+}
+
+func (rec *Recorder) redactJSON(v interface{}, remove bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, sub := range v {
+			if !rec.redact[k] {
+				rec.redactJSON(sub, remove)
+			} else if remove {
+				delete(v, k)
+			} else {
+				v[k] = redactedValue
+			}
+		}
+	case []interface{}:
+		for _, sub := range v {
+			rec.redactJSON(sub, remove)
+		}
+	}
+}
+
+// redactBody remove or replace the redacted fields of form or json body,
+// other bodies are returned as is
+func (rec *Recorder) redactBody(contentType string, body []byte, remove bool) []byte {
+	if len(body) == 0 {
+		return body
+	}
+	ctype, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case ctype == "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return body
+		}
+		rec.redactValues(values, remove)
+		return []byte(values.Encode())
+	case ctype == "application/json" || strings.HasSuffix(ctype, "+json"):
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err != nil {
+			return body
+		}
+		rec.redactJSON(v, remove)
+		data, err := json.Marshal(v)
+		if err != nil {
+			return body
+		}
+		return data
+	}
+	return body
+}
+
+func (rec *Recorder) redactURL(rawURL string, remove bool) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	values := u.Query()
+	rec.redactValues(values, remove)
+	u.RawQuery = values.Encode()
+	return u.String()
+}
+
+// matchKey normalize the request, the query and body fields are sorted and
+// the redacted ones are removed
+func (rec *Recorder) matchKey(method, rawURL, contentType string, body []byte) string {
+	return strings.ToUpper(method) + " " + rec.redactURL(rawURL, true) + "\n" +
+		string(rec.redactBody(contentType, body, true))
+}
+
+func (rec *Recorder) match(key string) *Interaction {
+	var last *Interaction
+	for _, it := range rec.interactions {
+		if it.key != key {
+			continue
+		}
+		if !it.used {
+			return it
+		}
+		last = it
+	}
+	return last
+}
+
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// RoundTrip ...
+func (rec *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	return rec.roundTrip(req, nil)
+}
+
+// roundTrip record by Transport of config, or by fallback if it's nil
+func (rec *Recorder) roundTrip(req *http.Request, fallback http.RoundTripper) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	contentType := req.Header.Get("Content-Type")
+	key := rec.matchKey(req.Method, req.URL.String(), contentType, body)
+
+	if rec.config.Mode != CassetteRecord {
+		rec.locker.Lock()
+		it := rec.match(key)
+		if it != nil {
+			it.used = true
+		}
+		rec.locker.Unlock()
+		if it != nil {
+			return it.replay(req)
+		}
+		if rec.config.Mode == CassetteReplay {
+			return nil, fmt.Errorf("%w: %v %v", ErrCassetteMiss, req.Method, req.URL)
+		}
+	}
+
+	next := rec.config.Transport
+	if next == nil {
+		next = fallback
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	it := &Interaction{key: key, used: true}
+	it.Request.Method = req.Method
+	it.Request.URL = rec.redactURL(req.URL.String(), false)
+	it.Request.Header = rec.redactHeader(req.Header)
+	it.Request.Body, it.Request.BodyEncoding = encodeCassetteBody(rec.redactBody(contentType, body, false))
+	it.Response.StatusCode = resp.StatusCode
+	it.Response.Header = rec.redactHeader(resp.Header)
+	it.Response.Body, it.Response.BodyEncoding = encodeCassetteBody(respBody)
+
+	rec.locker.Lock()
+	rec.interactions = append(rec.interactions, it)
+	err = rec.save()
+	rec.locker.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (it *Interaction) replay(req *http.Request) (*http.Response, error) {
+	body, err := decodeCassetteBody(it.Response.Body, it.Response.BodyEncoding)
+	if err != nil {
+		return nil, err
+	}
+	header := it.Response.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", it.Response.StatusCode, http.StatusText(it.Response.StatusCode)),
+		StatusCode:    it.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// Interactions ...
+func (rec *Recorder) Interactions() []*Interaction {
+	rec.locker.Lock()
+	defer rec.locker.Unlock()
+	return append([]*Interaction{}, rec.interactions...)
+}
+
+// Save write the cassette, it's called after every recorded interaction
+func (rec *Recorder) Save() error {
+	rec.locker.Lock()
+	defer rec.locker.Unlock()
+	return rec.save()
+}
+
+func (rec *Recorder) save() error {
+	data, err := json.MarshalIndent(rec.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(rec.config.Path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(rec.config.Path, data, 0644)
+}
@@ -0,0 +1,108 @@
+package netutils
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/asmexie/gopub/common"
+)
+
+func TestRecorder(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "cookie-secret"})
+		r.ParseForm()
+		w.Write([]byte("echo " + r.Form.Get("a")))
+	}))
+	defer srv.Close()
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	call := func(rec *Recorder, nonce string) (string, error) {
+		client := NewHTTPClient("", WithRecorder(rec))
+		client.SetURL("%s/api?b=2&a=1&%v=%v", srv.URL, KNameNonceStr, nonce)
+		client.SetFormBody(common.Map{"a": "x", KNameSign: nonce})
+		client.SetHeader("Authorization", "Bearer token-secret")
+		resp, err := client.Post()
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		data, err := ioutil.ReadAll(resp.Body)
+		return string(data), err
+	}
+
+	rec, err := NewRecorder(RecorderConfig{Path: path, Mode: CassetteRecord})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, err := call(rec, "n1"); err != nil || body != "echo x" {
+		t.Fatalf("record got %v, %v", body, err)
+	}
+	data, _ := ioutil.ReadFile(path)
+	if strings.Contains(string(data), "n1") || strings.Contains(string(data), "secret") {
+		t.Errorf("cassette is not redacted: %s", data)
+	}
+
+	rec, err = NewRecorder(RecorderConfig{Path: path, Mode: CassetteReplay})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, err := call(rec, "n2"); err != nil || body != "echo x" {
+		t.Fatalf("replay got %v, %v", body, err)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("replay hit server, hits %v", n)
+	}
+
+	client := NewHTTPClient("", WithRecorder(rec))
+	client.SetURL("%s/other", srv.URL)
+	if _, err := client.Get(); !errors.Is(err, ErrCassetteMiss) {
+		t.Errorf("expect cassette miss, got %v", err)
+	}
+}
+
+func TestRecorderShared(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+	rec, err := NewRecorder(RecorderConfig{Path: filepath.Join(t.TempDir(), "cassette.json"), Mode: CassetteRecord})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every client records by its own transport, the one of the first client
+	// is not saved into the recorder
+	bad := NewHTTPClient("", WithRecorder(rec))
+	bad.tr.Proxy = func(*http.Request) (*url.URL, error) {
+		return nil, errors.New("proxy down")
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s, err := NewHTTPClient("", WithRecorder(rec)).SetURL("%s/%d", srv.URL, i).GetResult()
+			if err != nil || s != fmt.Sprintf("/%d", i) {
+				t.Errorf("client %d got %v %v", i, s, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if _, err := bad.SetURL("%s/bad", srv.URL).Get(); err == nil {
+		t.Error("client of bad transport should fail")
+	}
+	if rec.config.Transport != nil || len(rec.Interactions()) != 4 {
+		t.Errorf("recorder is changed, transport %v interactions %v", rec.config.Transport, len(rec.Interactions()))
+	}
+}
@@ -1,18 +1,19 @@
 package netutils
 
 import (
-	"crypto/tls"
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
 	"github.com/asmexie/gopub/common"
-	"golang.org/x/net/proxy"
 )
 
 // HTTPClient ...
@@ -22,8 +23,48 @@ type HTTPClient struct {
 	reqParams map[string]interface{}
 	tr        http.Transport
 	resp      *http.Response
+	ctx       context.Context
+	optErr    error
+
+	// the transport chain is built after options, the order of options
+	// doesn't matter
+	retry    *RetryPolicy
+	breaker  *BreakerConfig
+	recorder *Recorder
+
+	// the settings of the next request, they are reset after it's sent
+	method      string
+	header      http.Header
+	cookies     []*http.Cookie
+	body        []byte
+	contentType string
+	bodyErr     error
+}
+
+// MultipartFile is a file part of multipart body
+type MultipartFile struct {
+	FieldName string
+	FileName  string
+	Reader    io.Reader
+}
+
+// HTTPStatusError is returned by DecodeJSON when the status is not 2xx
+type HTTPStatusError struct {
+	StatusCode int
+	URL        string
+	Body       []byte
+}
+
+func (e *HTTPStatusError) Error() string {
+	body := e.Body
+	if len(body) > 256 {
+		body = body[:256]
+	}
+	return fmt.Sprintf("http status %d, url:%v, body:%s", e.StatusCode, e.URL, body)
 }
 
+const maxErrorBodySize = 4 << 10
+
 // SetURL set url
 func (client *HTTPClient) SetURL(fmtURL string, fmtParams ...interface{}) *HTTPClient {
 	client.reqURL = fmt.Sprintf(fmtURL, fmtParams...)
@@ -42,15 +83,184 @@ func (client *HTTPClient) Timeout(d time.Duration) *HTTPClient {
 	return client
 }
 
+// WithContext set the context of requests, the request id and trace of ctx
+// are sent in headers
+func (client *HTTPClient) WithContext(ctx context.Context) *HTTPClient {
+	client.ctx = ctx
+	return client
+}
+
+// Context ...
+func (client *HTTPClient) Context() context.Context {
+	if client.ctx == nil {
+		return context.Background()
+	}
+	return client.ctx
+}
+
+// SetMethod set the method of the next request sent by Do, GetResult,
+// GetJSON or DecodeJSON, it's reset to GET after the request is sent. The
+// headers, cookies and body are reset too
+func (client *HTTPClient) SetMethod(method string) *HTTPClient {
+	client.method = strings.ToUpper(method)
+	return client
+}
+
+// SetHeader ...
+func (client *HTTPClient) SetHeader(key, value string) *HTTPClient {
+	if client.header == nil {
+		client.header = http.Header{}
+	}
+	client.header.Set(key, value)
+	return client
+}
+
+// SetHeaders ...
+func (client *HTTPClient) SetHeaders(headers map[string]string) *HTTPClient {
+	for k, v := range headers {
+		client.SetHeader(k, v)
+	}
+	return client
+}
+
+// AddCookie ...
+func (client *HTTPClient) AddCookie(cookie *http.Cookie) *HTTPClient {
+	client.cookies = append(client.cookies, cookie)
+	return client
+}
+
+// SetBody read all of body, so the request can be sent again
+func (client *HTTPClient) SetBody(body io.Reader, contentType string) *HTTPClient {
+	client.body, client.bodyErr = nil, nil
+	if body != nil {
+		client.body, client.bodyErr = ioutil.ReadAll(body)
+	}
+	client.contentType = contentType
+	return client
+}
+
+// SetJSONBody ...
+func (client *HTTPClient) SetJSONBody(v interface{}) *HTTPClient {
+	client.body, client.bodyErr = json.Marshal(v)
+	client.contentType = "application/json"
+	return client
+}
+
+// SetFormBody ...
+func (client *HTTPClient) SetFormBody(form common.Map) *HTTPClient {
+	client.body = []byte(MapToURLValues(form).Encode())
+	client.bodyErr = nil
+	client.contentType = "application/x-www-form-urlencoded"
+	return client
+}
+
+// SetMultipartBody ...
+func (client *HTTPClient) SetMultipartBody(fields common.Map, files ...MultipartFile) *HTTPClient {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	client.bodyErr = func() error {
+		for k, v := range fields {
+			if err := mw.WriteField(k, fmt.Sprintf("%v", v)); err != nil {
+				return err
+			}
+		}
+		for _, f := range files {
+			fw, err := mw.CreateFormFile(f.FieldName, f.FileName)
+			if err != nil {
+				return err
+			}
+			if _, err = io.Copy(fw, f.Reader); err != nil {
+				return err
+			}
+		}
+		return mw.Close()
+	}()
+	client.body = buf.Bytes()
+	client.contentType = mw.FormDataContentType()
+	return client
+}
+
+// NewRequest build the request of current settings
+func (client *HTTPClient) NewRequest() (*http.Request, error) {
+	if client.optErr != nil {
+		return nil, client.optErr
+	}
+	if client.bodyErr != nil {
+		return nil, client.bodyErr
+	}
+	method := client.method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if client.body != nil {
+		body = bytes.NewReader(client.body)
+	}
+	req, err := http.NewRequestWithContext(client.Context(), method, client.URL(), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range client.header {
+		req.Header[k] = append([]string(nil), vs...)
+	}
+	if client.contentType != "" && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", client.contentType)
+	}
+	for _, cookie := range client.cookies {
+		req.AddCookie(cookie)
+	}
+	InjectTrace(req)
+	return req, nil
+}
+
+// resetRequest clear the settings of the sent request, so they are not sent
+// again by the next request
+func (client *HTTPClient) resetRequest() {
+	client.method = ""
+	client.header = nil
+	client.cookies = nil
+	client.body, client.contentType, client.bodyErr = nil, "", nil
+}
+
+// Do send the request with the method set by SetMethod
+func (client *HTTPClient) Do() (resp *http.Response, err error) {
+	req, err := client.NewRequest()
+	client.resetRequest()
+	if err != nil {
+		return nil, err
+	}
+	return client.Client.Do(req)
+}
+
 // Get ...
 func (client *HTTPClient) Get() (resp *http.Response, err error) {
-	return client.Client.Get(client.URL())
+	return client.SetMethod(http.MethodGet).Do()
+}
+
+// Post ...
+func (client *HTTPClient) Post() (resp *http.Response, err error) {
+	return client.SetMethod(http.MethodPost).Do()
+}
+
+// Put ...
+func (client *HTTPClient) Put() (resp *http.Response, err error) {
+	return client.SetMethod(http.MethodPut).Do()
+}
+
+// Patch ...
+func (client *HTTPClient) Patch() (resp *http.Response, err error) {
+	return client.SetMethod(http.MethodPatch).Do()
+}
+
+// Delete ...
+func (client *HTTPClient) Delete() (resp *http.Response, err error) {
+	return client.SetMethod(http.MethodDelete).Do()
 }
 
 type processBodyProc = func(body io.Reader) error
 
 func (client *HTTPClient) readBody(pb processBodyProc) error {
-	resp, err := client.Get()
+	resp, err := client.Do()
 	if err != nil {
 		return err
 	}
@@ -68,8 +278,7 @@ func (client *HTTPClient) readBody(pb processBodyProc) error {
 // GetResult ...
 func (client *HTTPClient) GetResult() (string, error) {
 	var data []byte
-	var err error
-	client.readBody(func(body io.Reader) error {
+	err := client.readBody(func(body io.Reader) (err error) {
 		data, err = ioutil.ReadAll(body)
 		return err
 	})
@@ -94,6 +303,27 @@ func (client *HTTPClient) GetJSON() (common.Map, error) {
 
 }
 
+// DecodeJSON send the request and decode the json response into v, a
+// HTTPStatusError is returned if the status is not 2xx
+func (client *HTTPClient) DecodeJSON(v interface{}) error {
+	resp, err := client.Do()
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		return &HTTPStatusError{StatusCode: resp.StatusCode, URL: client.URL(), Body: body}
+	}
+	if v == nil {
+		return nil
+	}
+	if err = json.NewDecoder(resp.Body).Decode(v); err != nil && err != io.EOF {
+		return fmt.Errorf("decode json of url %v failed:%v", client.URL(), err)
+	}
+	return nil
+}
+
 // URL ...
 func (client *HTTPClient) URL() string {
 	var reqParams URLValues
@@ -111,33 +341,73 @@ func (client *HTTPClient) URL() string {
 	return reqURL
 }
 
+// HTTPClientOption ...
+type HTTPClientOption func(client *HTTPClient)
+
 // NewHTTPClient ...
-func NewHTTPClient(proxyAddr string) *HTTPClient {
+func NewHTTPClient(proxyAddr string, opts ...HTTPClientOption) *HTTPClient {
 	client := &HTTPClient{
 		Client: &http.Client{},
 	}
 	client.Transport = &client.tr
-	if proxyAddr != "" {
-		addr, err := ParseProxyAddr(proxyAddr)
-		if err != nil {
-			common.LogERR(err)
-			return client
-		}
-		switch addr.Protocol {
-		case PXYProtocolHTTP:
-			client.tr.Proxy = http.ProxyURL(&url.URL{
-				Host: "127.0.0.1:8888",
-			})
-		case PXYProtocolSocks5:
-			dialSocksProxy, err := proxy.SOCKS5("tcp", addr.Host+":"+addr.Port, nil, proxy.Direct)
-			if err != nil {
-				common.LogERR(err)
-				return client
-			}
-			client.tr.Dial = dialSocksProxy.Dial
-			client.tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-		}
+	client.setProxy(proxyAddr)
+	for _, opt := range opts {
+		opt(client)
 	}
-
+	client.buildTransport()
 	return client
 }
+
+// buildTransport wrap the transport by recorder, circuit breaker and retry
+// in order, so the breaker is checked and the recorder is used by every
+// attempt of retries
+func (client *HTTPClient) buildTransport() {
+	if client.recorder != nil {
+		client.Transport = &recordingTransport{rec: client.recorder, next: client.Transport}
+	}
+	if client.breaker != nil {
+		client.Transport = &breakerTransport{next: client.Transport, config: *client.breaker,
+			breakers: map[string]*hostBreaker{}}
+	}
+	if client.retry != nil {
+		client.Transport = &retryTransport{next: client.Transport, policy: *client.retry}
+	}
+}
+
+// failProxy make the requests fail with err, the transport fails too if it's
+// used by the Client directly
+func (client *HTTPClient) failProxy(err error) {
+	err = fmt.Errorf("invalid proxy:%v", err)
+	client.optErr = err
+	client.tr.Proxy = func(*http.Request) (*url.URL, error) {
+		return nil, err
+	}
+}
+
+// setProxy use the proxies separated by ",", a single http or https proxy
+// is used as the proxy of transport, others are used to dial connections.
+// If proxyAddr is invalid the requests fail with the error instead of
+// connecting directly
+func (client *HTTPClient) setProxy(proxyAddr string) {
+	if proxyAddr == "" {
+		return
+	}
+	chain, err := ParseProxyChain(proxyAddr)
+	if err == nil && len(chain) == 0 {
+		err = fmt.Errorf("no proxy in %q", proxyAddr)
+	}
+	if err != nil {
+		client.failProxy(err)
+		return
+	}
+	if len(chain) == 1 && (chain[0].Protocol == PXYProtocolHTTP || chain[0].Protocol == PXYProtocolHTTPS) {
+		client.tr.Proxy = http.ProxyURL(chain[0].URL())
+		return
+	}
+	dialer, err := NewProxyDialer(chain, nil)
+	if err != nil {
+		client.failProxy(err)
+		return
+	}
+	client.tr.DialContext = dialer.DialContext
+}
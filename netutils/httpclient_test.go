@@ -0,0 +1,104 @@
+package netutils
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+)
+
+func TestHTTPClientMethod(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"method":"` + r.Method + `"}`))
+	}))
+	defer srv.Close()
+
+	client := NewHTTPClient("").SetURL("%s", srv.URL)
+	resp, err := client.Post()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Request.Method != http.MethodPost {
+		t.Fatalf("post sent %v", resp.Request.Method)
+	}
+	// the method is reset after a request
+	if m, err := client.GetJSON(); err != nil || m["method"] != http.MethodGet {
+		t.Fatalf("get json after post got %v %v", m, err)
+	}
+	if s, err := client.SetMethod("put").GetResult(); err != nil || s != `{"method":"PUT"}` {
+		t.Fatalf("get result of put got %v %v", s, err)
+	}
+	var v struct{ Method string }
+	if err := client.DecodeJSON(&v); err != nil || v.Method != http.MethodGet {
+		t.Fatalf("decode json after put got %v %v", v, err)
+	}
+
+	if _, err := NewHTTPClient("").SetURL("http://127.0.0.1:1/none").GetResult(); err == nil {
+		t.Error("expect error of get result")
+	}
+}
+
+func TestHTTPClientReset(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		cookie, _ := r.Cookie("session")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"method":       r.Method,
+			"body":         string(body),
+			"content_type": r.Header.Get("Content-Type"),
+			"header":       r.Header.Get("X-Test"),
+			"cookie":       cookie != nil,
+		})
+	}))
+	defer srv.Close()
+
+	client := NewHTTPClient("").SetURL("%s", srv.URL)
+	m, err := client.SetJSONBody(map[string]int{"a": 1}).SetHeader("X-Test", "1").
+		AddCookie(&http.Cookie{Name: "session", Value: "s"}).SetMethod(http.MethodPost).GetJSON()
+	if err != nil || m["body"] != `{"a":1}` || m["content_type"] != "application/json" ||
+		m["header"] != "1" || m["cookie"] != true {
+		t.Fatalf("post got %v %v", m, err)
+	}
+	// nothing of the post is sent by the next request
+	m, err = client.GetJSON()
+	if err != nil || m["method"] != http.MethodGet || m["body"] != "" || m["content_type"] != "" ||
+		m["header"] != "" || m["cookie"] != false {
+		t.Fatalf("get after post got %v %v", m, err)
+	}
+
+	// the body error is reset too
+	if _, err := client.SetBody(iotest.ErrReader(errors.New("read failed")), "text/plain").Post(); err == nil {
+		t.Fatal("body error should fail the request")
+	}
+	if m, err = client.GetJSON(); err != nil || m["method"] != http.MethodGet {
+		t.Fatalf("get after body error got %v %v", m, err)
+	}
+}
+
+func TestHTTPClientInvalidProxy(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	defer srv.Close()
+
+	for _, proxy := range []string{"ftp://127.0.0.1:21", "socks5://127.0.0.1:1080,bad proxy", " , "} {
+		client := NewHTTPClient(proxy).SetURL("%s", srv.URL)
+		if _, err := client.Get(); err == nil {
+			t.Errorf("proxy %q should fail", proxy)
+		}
+		// the transport fails too when used directly
+		if resp, err := client.Client.Get(srv.URL); err == nil {
+			resp.Body.Close()
+			t.Errorf("client of proxy %q should fail", proxy)
+		}
+	}
+	if n := atomic.LoadInt32(&hits); n != 0 {
+		t.Errorf("server is connected directly %v times", n)
+	}
+}
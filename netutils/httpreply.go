@@ -1,6 +1,7 @@
 package netutils
 
 import (
+	"encoding/json"
 	"net/http"
 )
 
@@ -56,6 +57,18 @@ func (reply *HTTPReplyJSON) WriteReply(w http.ResponseWriter) {
 	WriteJSON(w, reply.Reply)
 }
 
+// WriteReplyStatus write the reply with http status code
+func (reply *HTTPReplyJSON) WriteReplyStatus(w http.ResponseWriter, httpStatus int) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	return json.NewEncoder(w).Encode(reply.Reply)
+}
+
+// Set set a field of reply
+func (reply *HTTPReplyJSON) Set(key string, value interface{}) {
+	reply.Reply[key] = value
+}
+
 // NewHTTPReplyJSONEx ...
 func NewHTTPReplyJSONEx(msgMap map[int]string, defaultErr int, msgKey, statusKey string) *HTTPReplyJSON {
 	return &HTTPReplyJSON{
@@ -0,0 +1,262 @@
+package netutils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetryAttempts  = 3
+	defaultRetryBaseDelay = 100 * time.Millisecond
+	defaultRetryMaxDelay  = 5 * time.Second
+
+	defaultBreakerFailures = 5
+	defaultBreakerTimeout  = 30 * time.Second
+)
+
+// HeaderIdempotencyKey make a POST or PATCH request retryable
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+// ErrCircuitOpen is returned when the circuit breaker of host is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+var defaultRetryStatus = []int{
+	http.StatusTooManyRequests, http.StatusBadGateway,
+	http.StatusServiceUnavailable, http.StatusGatewayTimeout,
+}
+
+// RetryPolicy ...
+type RetryPolicy struct {
+	// MaxAttempts include the first request, default 3
+	MaxAttempts int
+	// the delay before the nth retry is a random duration in
+	// [0, min(MaxDelay, BaseDelay*2^n)), Retry-After is respected
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// RetryStatus default 429, 502, 503 and 504
+	RetryStatus []int
+	// RetryNetErrors retry when the request failed without response
+	RetryNetErrors bool
+	// RetryNonIdempotent retry POST and PATCH without Idempotency-Key
+	RetryNonIdempotent bool
+}
+
+// BreakerConfig ...
+type BreakerConfig struct {
+	// Failures is the consecutive failures opening the breaker, default 5
+	Failures int
+	// OpenTimeout is how long the breaker is open before a probe, default 30s
+	OpenTimeout time.Duration
+	// HalfOpenProbes is the requests allowed when half open, default 1
+	HalfOpenProbes int
+}
+
+// WithRetry retry failed requests by policy
+func WithRetry(policy RetryPolicy) HTTPClientOption {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = defaultRetryAttempts
+	}
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = defaultRetryBaseDelay
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = defaultRetryMaxDelay
+	}
+	if policy.RetryStatus == nil {
+		policy.RetryStatus = defaultRetryStatus
+	}
+	return func(client *HTTPClient) {
+		client.retry = &policy
+	}
+}
+
+// WithCircuitBreaker fail fast with ErrCircuitOpen for the hosts keep failing,
+// network errors and 5xx responses are failures
+func WithCircuitBreaker(config BreakerConfig) HTTPClientOption {
+	if config.Failures <= 0 {
+		config.Failures = defaultBreakerFailures
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = defaultBreakerTimeout
+	}
+	if config.HalfOpenProbes <= 0 {
+		config.HalfOpenProbes = 1
+	}
+	return func(client *HTTPClient) {
+		client.breaker = &config
+	}
+}
+
+type retryTransport struct {
+	next   http.RoundTripper
+	policy RetryPolicy
+}
+
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get(HeaderIdempotencyKey) != ""
+}
+
+func (t *retryTransport) retryStatus(code int) bool {
+	for _, c := range t.policy.RetryStatus {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *retryTransport) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if sec, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && sec >= 0 {
+			d := time.Duration(sec) * time.Second
+			if d > t.policy.MaxDelay {
+				d = t.policy.MaxDelay
+			}
+			return d
+		}
+	}
+	d := t.policy.BaseDelay << uint(attempt)
+	if d <= 0 || d > t.policy.MaxDelay {
+		d = t.policy.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+func drainBody(resp *http.Response) {
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4<<10))
+	resp.Body.Close()
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	canRetry := t.policy.RetryNonIdempotent || idempotent(req)
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		canRetry = false
+	}
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+		resp, err := t.next.RoundTrip(req)
+		if !canRetry || attempt+1 >= t.policy.MaxAttempts {
+			return resp, err
+		}
+		if err != nil {
+			if !t.policy.RetryNetErrors || errors.Is(err, ErrCircuitOpen) || ctx.Err() != nil {
+				return resp, err
+			}
+		} else if !t.retryStatus(resp.StatusCode) {
+			return resp, nil
+		}
+
+		delay := t.backoff(attempt, resp)
+		if resp != nil {
+			drainBody(resp)
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+type hostBreaker struct {
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probes   int
+}
+
+type breakerTransport struct {
+	next     http.RoundTripper
+	config   BreakerConfig
+	locker   sync.Mutex
+	breakers map[string]*hostBreaker
+}
+
+func (t *breakerTransport) allow(host string) bool {
+	t.locker.Lock()
+	defer t.locker.Unlock()
+	b, ok := t.breakers[host]
+	if !ok {
+		b = &hostBreaker{}
+		t.breakers[host] = b
+	}
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < t.config.OpenTimeout {
+			return false
+		}
+		b.state, b.probes = breakerHalfOpen, 0
+		fallthrough
+	case breakerHalfOpen:
+		if b.probes >= t.config.HalfOpenProbes {
+			return false
+		}
+		b.probes++
+	}
+	return true
+}
+
+func (t *breakerTransport) record(host string, success bool) {
+	t.locker.Lock()
+	defer t.locker.Unlock()
+	b := t.breakers[host]
+	if success {
+		b.state, b.failures = breakerClosed, 0
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= t.config.Failures {
+		b.state, b.openedAt = breakerOpen, time.Now()
+	}
+}
+
+// release the probe of half open breaker without result
+func (t *breakerTransport) release(host string) {
+	t.locker.Lock()
+	defer t.locker.Unlock()
+	if b := t.breakers[host]; b.state == breakerHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	if !t.allow(host) {
+		return nil, ErrCircuitOpen
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil && errors.Is(err, context.Canceled) {
+		// canceled by caller, it's not the fault of host
+		t.release(host)
+		return resp, err
+	}
+	t.record(host, err == nil && resp.StatusCode < http.StatusInternalServerError)
+	return resp, err
+}
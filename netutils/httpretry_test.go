@@ -0,0 +1,170 @@
+package netutils
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// statusServer reply the status returned by status of the nth request, 429
+// is replied with Retry-After of 1 second
+func statusServer(status func(n int32, r *http.Request) int) (*httptest.Server, *int32) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		code := status(atomic.AddInt32(&hits, 1), r)
+		if code == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "1")
+		}
+		w.WriteHeader(code)
+		w.Write(body)
+	}))
+	return srv, &hits
+}
+
+func TestRetry(t *testing.T) {
+	srv, hits := statusServer(func(n int32, r *http.Request) int {
+		if n%3 != 0 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+	defer srv.Close()
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	send := func(policy RetryPolicy, method string, header map[string]string) (int, string) {
+		atomic.StoreInt32(hits, 0)
+		client := NewHTTPClient("", WithRetry(policy)).SetURL("%s", srv.URL).SetHeaders(header)
+		client.SetBody(strings.NewReader("body"), "text/plain")
+		resp, err := client.SetMethod(method).Do()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if code, body := send(policy, http.MethodPut, nil); code != http.StatusOK || body != "body" || atomic.LoadInt32(hits) != 3 {
+		t.Errorf("put got %v %v hits %v", code, body, atomic.LoadInt32(hits))
+	}
+	policy.MaxAttempts = 2
+	if code, _ := send(policy, http.MethodGet, nil); code != http.StatusServiceUnavailable || atomic.LoadInt32(hits) != 2 {
+		t.Errorf("get got %v hits %v", code, atomic.LoadInt32(hits))
+	}
+	policy.MaxAttempts = 3
+	if code, _ := send(policy, http.MethodPost, nil); code != http.StatusServiceUnavailable || atomic.LoadInt32(hits) != 1 {
+		t.Errorf("post without idempotency key got %v hits %v", code, atomic.LoadInt32(hits))
+	}
+	code, body := send(policy, http.MethodPost, map[string]string{HeaderIdempotencyKey: "k"})
+	if code != http.StatusOK || body != "body" || atomic.LoadInt32(hits) != 3 {
+		t.Errorf("post with idempotency key got %v %v hits %v", code, body, atomic.LoadInt32(hits))
+	}
+	policy.RetryStatus = []int{http.StatusBadGateway}
+	if code, _ := send(policy, http.MethodGet, nil); code != http.StatusServiceUnavailable || atomic.LoadInt32(hits) != 1 {
+		t.Errorf("status not retried got %v hits %v", code, atomic.LoadInt32(hits))
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	rt := &retryTransport{policy: RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: 2 * time.Second}}
+	after := func(v string) *http.Response {
+		return &http.Response{Header: http.Header{"Retry-After": []string{v}}}
+	}
+	if d := rt.backoff(0, after("1")); d != time.Second {
+		t.Errorf("retry after 1 got %v", d)
+	}
+	if d := rt.backoff(0, after("60")); d != 2*time.Second {
+		t.Errorf("retry after is not limited by max delay, got %v", d)
+	}
+	for attempt := 0; attempt < 20; attempt++ {
+		if d := rt.backoff(attempt, after("")); d <= 0 || d > 2*time.Second {
+			t.Errorf("backoff %v got %v", attempt, d)
+		}
+	}
+
+	srv, hits := statusServer(func(n int32, r *http.Request) int {
+		if n == 1 {
+			return http.StatusTooManyRequests
+		}
+		return http.StatusOK
+	})
+	defer srv.Close()
+	client := NewHTTPClient("", WithRetry(RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: 50 * time.Millisecond}))
+	// the retry after is limited by max delay
+	start := time.Now()
+	resp, err := client.SetURL("%s", srv.URL).Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || atomic.LoadInt32(hits) != 2 || time.Since(start) < 50*time.Millisecond {
+		t.Errorf("got %v hits %v after %v", resp.StatusCode, atomic.LoadInt32(hits), time.Since(start))
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var fail int32 = 1
+	srv, hits := statusServer(func(n int32, r *http.Request) int {
+		if atomic.LoadInt32(&fail) != 0 {
+			return http.StatusInternalServerError
+		}
+		return http.StatusOK
+	})
+	defer srv.Close()
+	client := NewHTTPClient("", WithCircuitBreaker(BreakerConfig{Failures: 2, OpenTimeout: 50 * time.Millisecond}))
+	get := func() (int, error) {
+		resp, err := client.SetURL("%s", srv.URL).Get()
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		if code, err := get(); code != http.StatusInternalServerError {
+			t.Fatalf("closed breaker got %v %v", code, err)
+		}
+	}
+	if _, err := get(); !errors.Is(err, ErrCircuitOpen) || atomic.LoadInt32(hits) != 2 {
+		t.Fatalf("open breaker got %v hits %v", err, atomic.LoadInt32(hits))
+	}
+	// a failed probe of half open breaker open it again
+	time.Sleep(60 * time.Millisecond)
+	if code, _ := get(); code != http.StatusInternalServerError || atomic.LoadInt32(hits) != 3 {
+		t.Fatalf("half open probe got %v hits %v", code, atomic.LoadInt32(hits))
+	}
+	if _, err := get(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("reopened breaker got %v", err)
+	}
+	// a successful probe close it
+	atomic.StoreInt32(&fail, 0)
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if code, err := get(); code != http.StatusOK {
+			t.Fatalf("closed breaker got %v %v", code, err)
+		}
+	}
+}
+
+func TestRetryWithBreaker(t *testing.T) {
+	srv, hits := statusServer(func(n int32, r *http.Request) int {
+		return http.StatusServiceUnavailable
+	})
+	defer srv.Close()
+	retry := WithRetry(RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond})
+	breaker := WithCircuitBreaker(BreakerConfig{Failures: 2, OpenTimeout: time.Minute})
+	for _, opts := range [][]HTTPClientOption{{retry, breaker}, {breaker, retry}} {
+		atomic.StoreInt32(hits, 0)
+		// every attempt is checked by the breaker whatever the order of options
+		_, err := NewHTTPClient("", opts...).SetURL("%s", srv.URL).Get()
+		if !errors.Is(err, ErrCircuitOpen) || atomic.LoadInt32(hits) != 2 {
+			t.Errorf("got %v hits %v", err, atomic.LoadInt32(hits))
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package netutils
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// ErrPinMismatch is returned when no certificate of server matches the pins
+var ErrPinMismatch = errors.New("certificate pin mismatch")
+
+// TLSConfig is the tls settings of HTTPClient, the server certificate is
+// always verified
+type TLSConfig struct {
+	// CAFiles and CAPEM are the PEM bundles of trusted CAs, they replace the
+	// system roots unless SystemRoots is set
+	CAFiles     []string
+	CAPEM       []byte
+	SystemRoots bool
+	// CertFile and KeyFile is the client certificate for mutual tls
+	CertFile     string
+	KeyFile      string
+	Certificates []tls.Certificate
+	// Pins is the base64 sha256 of SubjectPublicKeyInfo, "sha256/" prefix is
+	// allowed, the connection is accepted if any certificate of the verified
+	// chain matches any pin, so backup pins can be listed together
+	Pins []string
+	// MinVersion default tls 1.2
+	MinVersion uint16
+	ServerName string
+}
+
+// SPKIPin return the pin of cert used by TLSConfig.Pins
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func parsePins(pins []string) (map[string]bool, error) {
+	set := map[string]bool{}
+	for _, pin := range pins {
+		pin = strings.TrimPrefix(strings.TrimSpace(pin), "sha256/")
+		b, err := base64.StdEncoding.DecodeString(pin)
+		if err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("invalid pin %v", pin)
+		}
+		set[pin] = true
+	}
+	return set, nil
+}
+
+// NewTLSConfig ...
+func NewTLSConfig(config TLSConfig) (*tls.Config, error) {
+	tc := &tls.Config{
+		MinVersion: config.MinVersion,
+		ServerName: config.ServerName,
+	}
+	if tc.MinVersion == 0 {
+		tc.MinVersion = tls.VersionTLS12
+	}
+
+	if len(config.CAFiles) > 0 || len(config.CAPEM) > 0 {
+		pool := x509.NewCertPool()
+		if config.SystemRoots {
+			if sys, err := x509.SystemCertPool(); err == nil {
+				pool = sys
+			}
+		}
+		bundles := [][]byte{}
+		for _, f := range config.CAFiles {
+			data, err := ioutil.ReadFile(f)
+			if err != nil {
+				return nil, err
+			}
+			bundles = append(bundles, data)
+		}
+		if len(config.CAPEM) > 0 {
+			bundles = append(bundles, config.CAPEM)
+		}
+		for _, data := range bundles {
+			if !pool.AppendCertsFromPEM(data) {
+				return nil, fmt.Errorf("no ca certificate is found in bundle")
+			}
+		}
+		tc.RootCAs = pool
+	}
+
+	tc.Certificates = append(tc.Certificates, config.Certificates...)
+	if config.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tc.Certificates = append(tc.Certificates, cert)
+	}
+
+	if len(config.Pins) > 0 {
+		pins, err := parsePins(config.Pins)
+		if err != nil {
+			return nil, err
+		}
+		// VerifyConnection is called after the chain is verified, and for
+		// resumed sessions too
+		tc.VerifyConnection = func(cs tls.ConnectionState) error {
+			for _, chain := range cs.VerifiedChains {
+				for _, cert := range chain {
+					if pins[SPKIPin(cert)] {
+						return nil
+					}
+				}
+			}
+			return ErrPinMismatch
+		}
+	}
+	return tc, nil
+}
+
+// WithTLS set the tls config of client, if config is invalid the requests
+// fail with the error instead of falling back to the default settings
+func WithTLS(config TLSConfig) HTTPClientOption {
+	return func(client *HTTPClient) {
+		tc, err := NewTLSConfig(config)
+		if err != nil {
+			client.optErr = err
+			tc = &tls.Config{VerifyConnection: func(tls.ConnectionState) error {
+				return err
+			}}
+		}
+		client.tr.TLSClientConfig = tc
+	}
+}
@@ -0,0 +1,149 @@
+package netutils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func certPEM(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+// newTestCert create a certificate signed by parent, it's self signed if
+// parent is nil
+func newTestCert(t *testing.T, name string, isCA bool, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, interface{}(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func tlsGet(config TLSConfig, url string) error {
+	resp, err := NewHTTPClient("", WithTLS(config)).SetURL("%s", url).Get()
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
+
+func TestTLSPins(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	ca := certPEM(srv.Certificate())
+	pin := "sha256/" + SPKIPin(srv.Certificate())
+	otherPin := SPKIPin(newTestCert(t, "other", false, nil).Leaf)
+
+	if err := tlsGet(TLSConfig{}, srv.URL); err == nil {
+		t.Error("certificate of unknown ca should be rejected")
+	}
+	if err := tlsGet(TLSConfig{CAPEM: ca}, srv.URL); err != nil {
+		t.Errorf("ca got %v", err)
+	}
+	if err := tlsGet(TLSConfig{CAPEM: ca, Pins: []string{pin}}, srv.URL); err != nil {
+		t.Errorf("pin match got %v", err)
+	}
+	if err := tlsGet(TLSConfig{CAPEM: ca, Pins: []string{otherPin}}, srv.URL); !errors.Is(err, ErrPinMismatch) {
+		t.Errorf("pin mismatch got %v", err)
+	}
+	if err := tlsGet(TLSConfig{CAPEM: ca, Pins: []string{otherPin, pin}}, srv.URL); err != nil {
+		t.Errorf("backup pin got %v", err)
+	}
+	if err := tlsGet(TLSConfig{CAPEM: ca, Pins: []string{"bad"}}, srv.URL); err == nil {
+		t.Error("invalid pin should fail")
+	}
+
+	dir := t.TempDir()
+	caFile, badFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "bad.pem")
+	ioutil.WriteFile(caFile, ca, 0600)
+	ioutil.WriteFile(badFile, []byte("no certificate"), 0600)
+	if err := tlsGet(TLSConfig{CAFiles: []string{caFile}}, srv.URL); err != nil {
+		t.Errorf("ca file got %v", err)
+	}
+	for _, f := range []string{filepath.Join(dir, "none.pem"), badFile} {
+		client := NewHTTPClient("", WithTLS(TLSConfig{CAFiles: []string{f}}))
+		if client.optErr == nil {
+			t.Errorf("ca file %v should set option error", f)
+		}
+		if _, err := client.SetURL("%s", srv.URL).Get(); err != client.optErr {
+			t.Errorf("ca file %v got %v", f, err)
+		}
+	}
+}
+
+func TestTLSClientCert(t *testing.T) {
+	ca := newTestCert(t, "client ca", true, nil)
+	cert := newTestCert(t, "client", false, &ca)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 || r.TLS.PeerCertificates[0].Subject.CommonName != "client" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool, MaxVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	defer srv.Close()
+	serverCA := certPEM(srv.Certificate())
+
+	if err := tlsGet(TLSConfig{CAPEM: serverCA}, srv.URL); err == nil {
+		t.Error("handshake without client certificate should fail")
+	}
+	if err := tlsGet(TLSConfig{CAPEM: serverCA, Certificates: []tls.Certificate{cert}}, srv.URL); err != nil {
+		t.Errorf("client certificate got %v", err)
+	}
+
+	dir := t.TempDir()
+	key, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	ioutil.WriteFile(certFile, certPEM(cert.Leaf), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}), 0600)
+	if err := tlsGet(TLSConfig{CAPEM: serverCA, CertFile: certFile, KeyFile: keyFile}, srv.URL); err != nil {
+		t.Errorf("client certificate file got %v", err)
+	}
+
+	// the server supports tls 1.2 only
+	err = tlsGet(TLSConfig{CAPEM: serverCA, Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS13}, srv.URL)
+	if err == nil {
+		t.Error("min version should be respected")
+	}
+}
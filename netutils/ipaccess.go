@@ -0,0 +1,134 @@
+package netutils
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// PrivateNets are loopback, private and link local networks
+var PrivateNets = MustParseIPNetList(
+	"127.0.0.0/8", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "169.254.0.0/16",
+	"::1/128", "fc00::/7", "fe80::/10")
+
+// IPAccessConfig ...
+type IPAccessConfig struct {
+	Allow          []string
+	Deny           []string
+	TrustedProxies []string
+}
+
+// IPAccess allow or deny client by ip networks, deny rules are checked
+// first, every ip not denied is allowed when there is no allow rule
+type IPAccess struct {
+	allow   IPNetList
+	deny    IPNetList
+	trusted IPNetList
+}
+
+// NewIPAccess ...
+func NewIPAccess(config IPAccessConfig) (*IPAccess, error) {
+	var err error
+	a := &IPAccess{}
+	if a.allow, err = ParseIPNetList(config.Allow); err != nil {
+		return nil, err
+	}
+	if a.deny, err = ParseIPNetList(config.Deny); err != nil {
+		return nil, err
+	}
+	if a.trusted, err = ParseIPNetList(config.TrustedProxies); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// NewIPAccessWithNets ...
+func NewIPAccessWithNets(allow, deny, trusted IPNetList) *IPAccess {
+	return &IPAccess{allow: allow, deny: deny, trusted: trusted}
+}
+
+// AllowedIP ...
+func (a *IPAccess) AllowedIP(ip net.IP) bool {
+	if a == nil {
+		return true
+	}
+	if ip == nil || a.deny.ContainsIP(ip) {
+		return false
+	}
+	return len(a.allow) == 0 || a.allow.ContainsIP(ip)
+}
+
+// Allowed check an ip or host:port address
+func (a *IPAccess) Allowed(addr string) bool {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return a.AllowedIP(net.ParseIP(addr))
+}
+
+// ClientIP return the client ip of request
+func (a *IPAccess) ClientIP(r *http.Request) string {
+	if a == nil {
+		return ClientIP(r, nil)
+	}
+	return ClientIP(r, a.trusted)
+}
+
+// AllowedRequest ...
+func (a *IPAccess) AllowedRequest(r *http.Request) bool {
+	return a.Allowed(a.ClientIP(r))
+}
+
+// Handler return 403 to the denied clients
+func (a *IPAccess) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.AllowedRequest(r) {
+			http.Error(w, "403 Forbidden", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// ClientIP return the real client ip of request, X-Forwarded-For and
+// X-Real-IP are only used when the peer is a trusted proxy, the forwarded
+// chain is walked from right to left until an untrusted address
+func ClientIP(r *http.Request, trusted IPNetList) string {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	if !trusted.Contains(ip) {
+		return ip
+	}
+
+	var hops []string
+	for _, v := range r.Header[cXForwardedFor] {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	if len(hops) == 0 {
+		if realIP := strings.TrimSpace(r.Header.Get(cXRealIP)); net.ParseIP(realIP) != nil {
+			return realIP
+		}
+		return ip
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !trusted.Contains(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// Trusted return the trusted proxy networks
+func (a *IPAccess) Trusted() IPNetList {
+	if a == nil {
+		return nil
+	}
+	return a.trusted
+}
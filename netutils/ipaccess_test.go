@@ -0,0 +1,43 @@
+package netutils
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPAccess(t *testing.T) {
+	access, err := NewIPAccess(IPAccessConfig{
+		Allow:          []string{"10.0.0.0/8", "192.168.1.10"},
+		Deny:           []string{"10.0.0.66"},
+		TrustedProxies: []string{"127.0.0.1", "172.16.0.0/12"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		remoteAddr string
+		forwarded  string
+		clientIP   string
+		allowed    bool
+	}{
+		{"10.1.1.1:80", "", "10.1.1.1", true},
+		{"10.0.0.66:80", "", "10.0.0.66", false},
+		{"8.8.8.8:80", "10.1.1.1", "8.8.8.8", false},
+		{"127.0.0.1:80", "8.8.8.8, 192.168.1.10, 172.16.3.3", "192.168.1.10", true},
+		{"127.0.0.1:80", "10.1.1.1, 10.0.0.66", "10.0.0.66", false},
+		{"127.0.0.1:80", "bad, 172.16.3.3", "172.16.3.3", false},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = c.remoteAddr
+		if c.forwarded != "" {
+			r.Header.Set(cXForwardedFor, c.forwarded)
+		}
+		if ip := access.ClientIP(r); ip != c.clientIP {
+			t.Errorf("%+v got client ip %v", c, ip)
+		}
+		if ok := access.AllowedRequest(r); ok != c.allowed {
+			t.Errorf("%+v got allowed %v", c, ok)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package netutils
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// IPNetList is a list of networks, a single ip is a network with full mask
+type IPNetList []*net.IPNet
+
+// ParseIPNetList parse ips and cidrs like "127.0.0.1", "10.0.0.0/8", "::1"
+func ParseIPNetList(items []string) (IPNetList, error) {
+	nets := IPNetList{}
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if strings.Contains(item, "/") {
+			_, ipnet, err := net.ParseCIDR(item)
+			if err != nil {
+				return nil, err
+			}
+			nets = append(nets, ipnet)
+			continue
+		}
+		ip := net.ParseIP(item)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid ip %v", item)
+		}
+		bits := 128
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 32
+		}
+		nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return nets, nil
+}
+
+// MustParseIPNetList ...
+func MustParseIPNetList(items ...string) IPNetList {
+	nets, err := ParseIPNetList(items)
+	if err != nil {
+		panic(err)
+	}
+	return nets
+}
+
+// ContainsIP ...
+func (nets IPNetList) ContainsIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipnet := range nets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains check the ip string, a host:port address is accepted too
+func (nets IPNetList) Contains(ip string) bool {
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	return nets.ContainsIP(net.ParseIP(strings.TrimSpace(ip)))
+}
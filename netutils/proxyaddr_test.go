@@ -0,0 +1,38 @@
+package netutils
+
+import "testing"
+
+func TestParseProxyAddr(t *testing.T) {
+	cases := []struct {
+		addr   string
+		expect ProxyAddr
+		str    string
+	}{
+		{"127.0.0.1:8080", ProxyAddr{Protocol: "http", Host: "127.0.0.1", Port: "8080"}, "http://127.0.0.1:8080"},
+		{"proxy.local", ProxyAddr{Protocol: "http", Host: "proxy.local", Port: "80"}, "http://proxy.local:80"},
+		{"HTTPS://u:p@proxy.local", ProxyAddr{Protocol: "https", Host: "proxy.local", Port: "443", User: "u", Password: "p"}, "https://u:p@proxy.local:443"},
+		{"socks5://user:p%40ss@[::1]:1081", ProxyAddr{Protocol: "socks5", Host: "::1", Port: "1081", User: "user", Password: "p@ss"}, "socks5://user:p%40ss@[::1]:1081"},
+		{"socks5h://user@10.0.0.1", ProxyAddr{Protocol: "socks5", Host: "10.0.0.1", Port: "1080", User: "user", RemoteDNS: true}, "socks5h://user@10.0.0.1:1080"},
+	}
+	for _, c := range cases {
+		addr, err := ParseProxyAddr(c.addr)
+		if err != nil {
+			t.Fatalf("parse %v failed:%v", c.addr, err)
+		}
+		if addr != c.expect {
+			t.Errorf("parse %v got %+v", c.addr, addr)
+		}
+		if addr.String() != c.str {
+			t.Errorf("%v got string %v", c.addr, addr.String())
+		}
+		if back, err := ParseProxyAddr(addr.String()); err != nil || back != addr {
+			t.Errorf("%v round trip got %+v, %v", c.addr, back, err)
+		}
+	}
+
+	for _, addr := range []string{"ftp://host:21", "http://", "socks5://::1:1080", "http://host/path"} {
+		if _, err := ParseProxyAddr(addr); err == nil {
+			t.Errorf("parse %v expect error", addr)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package netutils
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+const defaultProxyDialTimeout = 30 * time.Second
+
+// ContextDialer ...
+type ContextDialer interface {
+	Dial(network, addr string) (net.Conn, error)
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+type dialContextFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+func (f dialContextFunc) Dial(network, addr string) (net.Conn, error) {
+	return f(context.Background(), network, addr)
+}
+
+func (f dialContextFunc) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return f(ctx, network, addr)
+}
+
+// ParseProxyChain parse proxies separated by ",", the connection is made
+// through them in order
+func ParseProxyChain(addrs string) (chain []ProxyAddr, err error) {
+	for _, s := range strings.Split(addrs, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		addr, err := ParseProxyAddr(s)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, addr)
+	}
+	return chain, nil
+}
+
+// NewProxyDialer return a dialer connecting through the proxies in order,
+// forward is used to connect the first proxy, it's a net.Dialer if nil
+func NewProxyDialer(chain []ProxyAddr, forward ContextDialer) (ContextDialer, error) {
+	if forward == nil {
+		forward = &net.Dialer{Timeout: defaultProxyDialTimeout, KeepAlive: 30 * time.Second}
+	}
+	d := forward
+	for _, addr := range chain {
+		next, err := proxyHopDialer(addr, d)
+		if err != nil {
+			return nil, err
+		}
+		d = next
+	}
+	return d, nil
+}
+
+func proxyHopDialer(addr ProxyAddr, forward ContextDialer) (ContextDialer, error) {
+	switch strings.ToLower(addr.Protocol) {
+	case PXYProtocolSocks5:
+		var auth *proxy.Auth
+		if addr.User != "" {
+			auth = &proxy.Auth{User: addr.User, Password: addr.Password}
+		}
+		d, err := proxy.SOCKS5("tcp", addr.HostPort(), auth, forward)
+		if err != nil {
+			return nil, err
+		}
+		cd, ok := d.(ContextDialer)
+		if !ok {
+			cd = dialContextFunc(func(ctx context.Context, network, target string) (net.Conn, error) {
+				return d.Dial(network, target)
+			})
+		}
+		if addr.RemoteDNS {
+			return cd, nil
+		}
+		return dialContextFunc(func(ctx context.Context, network, target string) (net.Conn, error) {
+			target, err := resolveTarget(ctx, target)
+			if err != nil {
+				return nil, err
+			}
+			return cd.DialContext(ctx, network, target)
+		}), nil
+	case PXYProtocolHTTP, PXYProtocolHTTPS:
+		return dialContextFunc(func(ctx context.Context, network, target string) (net.Conn, error) {
+			return dialConnect(ctx, addr, forward, target)
+		}), nil
+	}
+	return nil, fmt.Errorf("not support proxy protocol %v", addr.Protocol)
+}
+
+// resolveTarget resolve the host of target locally for socks5 without
+// remote dns
+func resolveTarget(ctx context.Context, target string) (string, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(host) != nil {
+		return target, nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(addrs[0].IP.String(), port), nil
+}
+
+// bufferedConn keep the bytes read by bufio after the CONNECT response
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// dialConnect make a tunnel to target by CONNECT of http or https proxy
+func dialConnect(ctx context.Context, addr ProxyAddr, forward ContextDialer, target string) (conn net.Conn, err error) {
+	conn, err = forward.DialContext(ctx, "tcp", addr.HostPort())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			conn.Close()
+		}
+	}()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	if strings.ToLower(addr.Protocol) == PXYProtocolHTTPS {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: addr.Host})
+		if err = tlsConn.HandshakeContext(ctx); err != nil {
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: target},
+		Host:   target,
+		Header: http.Header{},
+	}
+	if addr.User != "" {
+		cred := base64.StdEncoding.EncodeToString([]byte(addr.User + ":" + addr.Password))
+		req.Header.Set("Proxy-Authorization", "Basic "+cred)
+	}
+	if err = req.Write(conn); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("proxy %v connect %v failed: %v", addr.HostPort(), target, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
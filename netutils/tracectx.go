@@ -0,0 +1,50 @@
+package netutils
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/asmexie/gopub/common"
+)
+
+// trace headers
+const (
+	HeaderRequestID   = "X-Request-Id"
+	HeaderTraceParent = "traceparent"
+	HeaderTraceState  = "tracestate"
+)
+
+// a request id from client is only accepted when it is short and printable
+var reRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// TraceFromRequest read the trace of incoming request, the span of server is
+// a child of the caller's, a new trace is created when the request has no
+// valid traceparent
+func TraceFromRequest(r *http.Request) *common.TraceContext {
+	tc, err := common.ParseTraceParent(r.Header.Get(HeaderTraceParent))
+	if err != nil {
+		tc = common.NewTraceContext()
+	} else {
+		tc = tc.Child()
+	}
+	if id := r.Header.Get(HeaderRequestID); reRequestID.MatchString(id) {
+		tc.RequestID = id
+	} else if tc.RequestID == "" {
+		tc.RequestID = tc.TraceID
+	}
+	return tc
+}
+
+// InjectTrace set the trace headers of outgoing request from its context
+func InjectTrace(req *http.Request) {
+	tc := common.TraceFrom(req.Context())
+	if tc == nil {
+		return
+	}
+	if tc.RequestID != "" && req.Header.Get(HeaderRequestID) == "" {
+		req.Header.Set(HeaderRequestID, tc.RequestID)
+	}
+	if req.Header.Get(HeaderTraceParent) == "" {
+		req.Header.Set(HeaderTraceParent, tc.Child().TraceParent())
+	}
+}
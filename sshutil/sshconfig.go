@@ -13,9 +13,9 @@ import (
 	"time"
 
 	"github.com/asmexie/gopub/common"
+	"github.com/asmexie/gopub/netutils"
 	"github.com/asmexie/go-logger/logger"
 	"golang.org/x/crypto/ssh"
-	"golang.org/x/net/proxy"
 )
 
 var priKeyPassMap = make(map[string]string)
@@ -162,20 +162,25 @@ func (p SSHConfig) timeout() time.Duration {
 	return time.Second * time.Duration(p.Timeout)
 }
 
-// GetDialConn ...
+// GetDialConn dial addr by proxy, proxyAddr is parsed by
+// netutils.ParseProxyAddrScheme and it's socks5h if the scheme is omitted
 func (p SSHConfig) GetDialConn(network, addr, proxyAddr string) (net.Conn, error) {
 	timeout := p.timeout()
-	if proxyAddr == "" {
+	if strings.TrimSpace(proxyAddr) == "" {
 		return net.DialTimeout(network, addr, timeout)
 	}
-	dialSocksProxy, err := proxy.SOCKS5("tcp", proxyAddr, nil, &net.Dialer{
+	pxyAddr, err := netutils.ParseProxyAddrScheme(proxyAddr, netutils.PXYProtocolSocks5H)
+	if err != nil {
+		return nil, err
+	}
+	dialer, err := netutils.NewProxyDialer([]netutils.ProxyAddr{pxyAddr}, &net.Dialer{
 		Timeout:   timeout,
 		KeepAlive: timeout,
 	})
 	if err != nil {
 		return nil, err
 	}
-	return dialSocksProxy.Dial("tcp", addr)
+	return dialer.Dial("tcp", addr)
 }
 
 // DialSSH ...
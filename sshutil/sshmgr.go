@@ -331,3 +331,22 @@ func (sds *SSHDialersMgr) GetDialFunc() DialFunc {
 		return nil, errors.New("not found valid ssh client")
 	}
 }
+
+// Check return error if there is no live ssh client, it is used as health check
+func (sds *SSHDialersMgr) Check(ctx context.Context) error {
+	sshClient := sds.sshClient
+	if sshClient == nil || !sds.connIsValid {
+		return errors.New("no live ssh client")
+	}
+	res := make(chan error, 1)
+	go func() {
+		_, _, err := sshClient.SendRequest("keepalive@golang.org", true, nil)
+		res <- err
+	}()
+	select {
+	case err := <-res:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}